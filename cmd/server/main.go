@@ -12,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/middleware"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/redisclient"
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/routes"
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
 	"go.uber.org/zap"
@@ -40,10 +41,24 @@ func main() {
 	router := gin.New()
 
 	// Register middlewares
-	middleware.RegisterMiddlewares(router, cfg, logger)
+	if err := middleware.RegisterMiddlewares(router, cfg, logger); err != nil {
+		logger.Fatal("Failed to register middlewares", zap.Error(err))
+	}
+
+	// Create the Redis client shared by rate limiting, login protection, API keys and entitlements
+	redisClient, err := redisclient.New(cfg.Redis)
+	if err != nil {
+		logger.Fatal("Failed to create Redis client", zap.Error(err))
+	}
+	defer redisClient.Close()
+	logger.Info("Redis client created",
+		zap.String("mode", cfg.Redis.Mode),
+		zap.String("redis", redisclient.Describe(cfg.Redis)),
+		zap.Bool("tls", cfg.Redis.TLSEnabled),
+	)
 
 	// Register routes
-	routes.RegisterRoutes(router, cfg, logger)
+	routes.RegisterRoutes(router, cfg, logger, redisClient)
 
 	// Create server with timeouts
 	srv := &http.Server{
@@ -0,0 +1,128 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Supported verifier providers
+const (
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderReCaptcha = "recaptcha"
+	ProviderTurnstile = "turnstile"
+	ProviderFake      = "fake"
+)
+
+// defaultVerifyURLs are the siteverify endpoints of the hosted providers
+var defaultVerifyURLs = map[string]string{
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderReCaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// ErrUnknownProvider is returned for provider names that have no verifier
+var ErrUnknownProvider = errors.New("unknown challenge provider")
+
+// Result is the outcome of verifying a challenge token
+type Result struct {
+	Success    bool
+	Score      *float64 // Risk score for providers that return one (reCAPTCHA v3, hCaptcha Enterprise)
+	Hostname   string
+	ErrorCodes []string
+}
+
+// Verifier checks a challenge token solved by the client
+type Verifier interface {
+	// Provider returns the provider name reported upstream
+	Provider() string
+	// Verify checks the token. An error means the provider could not be asked.
+	Verify(ctx context.Context, token, remoteIP string) (Result, error)
+}
+
+// NewVerifier creates the verifier for a provider. verifyURL overrides the
+// provider's default endpoint; for the fake provider secret is the accepted token.
+func NewVerifier(provider, secret, verifyURL string, client *http.Client) (Verifier, error) {
+	if provider == ProviderFake {
+		return &FakeVerifier{ValidToken: secret}, nil
+	}
+
+	defaultURL, ok := defaultVerifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, provider)
+	}
+	if verifyURL == "" {
+		verifyURL = defaultURL
+	}
+	return &httpVerifier{provider: provider, secret: secret, verifyURL: verifyURL, client: client}, nil
+}
+
+// siteVerifyResponse is the response shared by the hCaptcha, reCAPTCHA and Turnstile siteverify APIs
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"`
+	Hostname   string   `json:"hostname"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// httpVerifier verifies tokens against a siteverify-style HTTP endpoint
+type httpVerifier struct {
+	provider  string
+	secret    string
+	verifyURL string
+	client    *http.Client
+}
+
+func (v *httpVerifier) Provider() string {
+	return v.provider
+}
+
+func (v *httpVerifier) Verify(ctx context.Context, token, remoteIP string) (Result, error) {
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("challenge verification request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("challenge verification endpoint returned %d", resp.StatusCode)
+	}
+
+	var body siteVerifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return Result{}, fmt.Errorf("failed to parse challenge verification response: %w", err)
+	}
+	return Result{Success: body.Success, Score: body.Score, Hostname: body.Hostname, ErrorCodes: body.ErrorCodes}, nil
+}
+
+// FakeVerifier accepts a single fixed token. It is meant for local development and tests.
+type FakeVerifier struct {
+	ValidToken string
+}
+
+func (v *FakeVerifier) Provider() string {
+	return ProviderFake
+}
+
+func (v *FakeVerifier) Verify(ctx context.Context, token, remoteIP string) (Result, error) {
+	if v.ValidToken != "" && token == v.ValidToken {
+		return Result{Success: true}, nil
+	}
+	return Result{Success: false, ErrorCodes: []string{"invalid-input-response"}}, nil
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -9,12 +11,260 @@ import (
 
 // Config holds the application configuration
 type Config struct {
-	Server       ServerConfig
-	Services     ServicesConfig
-	Logging      LoggingConfig
-	JWT          JWTConfig
-	CORS         CORSConfig
-	RateLimiting RateLimitingConfig
+	Server        ServerConfig
+	Services      ServicesConfig
+	Logging       LoggingConfig
+	JWT           JWTConfig
+	CORS          CORSConfig
+	RateLimiting  RateLimitingConfig
+	Session       SessionConfig
+	APIKeys       APIKeyConfig
+	OIDC          OIDCConfig
+	Policy        PolicyConfig
+	Ownership     OwnershipConfig
+	Identity      IdentityConfig
+	Introspection IntrospectionConfig
+	StepUp        StepUpConfig
+	IPFilter      IPFilterConfig
+	ClientIP      ClientIPConfig
+
+	LoginProtection LoginProtectionConfig
+	Challenge       ChallengeConfig
+	Impersonation   ImpersonationConfig
+	Audit           AuditConfig
+	Roles           RolesConfig
+	Verification    VerificationConfig
+	Entitlements    EntitlementsConfig
+	Concurrency     ConcurrencyConfig
+	Outbound        OutboundConfig
+	Redis           RedisConfig
+	Readiness       ReadinessConfig
+}
+
+// RedisConfig holds the connection settings of the Redis client shared by every gateway feature
+type RedisConfig struct {
+	Mode             string   // standalone, sentinel or cluster
+	Address          string   // Server address in standalone mode
+	Addresses        []string // Sentinel addresses, or cluster seed nodes
+	MasterName       string   // Sentinel master name
+	Username         string   // ACL username
+	Password         string
+	SentinelUsername string // Credentials of the sentinels, if they differ from the master's
+	SentinelPassword string
+	DB               int // Database index; must be 0 in cluster mode
+
+	TLSEnabled            bool
+	TLSCAFile             string // PEM bundle of CAs trusted for the server certificate; empty uses the system pool
+	TLSCertFile           string // Client certificate for mutual TLS
+	TLSKeyFile            string
+	TLSServerName         string // Overrides the name verified in the server certificate
+	TLSInsecureSkipVerify bool   // Disables certificate verification; for development only
+
+	PoolSize     int // Connections per node; zero uses ten per CPU
+	MinIdleConns int
+	MaxRetries   int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	PoolTimeout  time.Duration // How long to wait for a free connection
+}
+
+// ReadinessConfig holds the dependencies the readiness endpoint checks
+type ReadinessConfig struct {
+	RequireRedis bool // Report not ready while Redis is unreachable
+}
+
+// ConcurrencyConfig holds the adaptive concurrency limits and load shedding settings
+type ConcurrencyConfig struct {
+	Enabled              bool
+	GlobalInitialLimit   int           // Starting in-flight limit across the gateway
+	GlobalMaxLimit       int           // Ceiling the global limit can grow to
+	UpstreamInitialLimit int           // Starting in-flight limit per upstream service
+	UpstreamMaxLimit     int           // Ceiling each upstream limit can grow to
+	MinLimit             int           // Floor every limit can shrink to
+	LatencyTarget        time.Duration // Requests slower than this count as congestion
+	BackoffRatio         float64       // Multiplier applied to a limit on congestion
+	AnonymousShare       float64       // Fraction of a limit anonymous requests may use
+	AuthenticatedShare   float64       // Fraction of a limit authenticated requests may use
+	HighPriorityRoutes   []string      // Routes that may use the whole limit
+	RetryAfter           time.Duration // Retry-After sent with shed requests
+}
+
+// outboundUpstreams are the upstream services outbound limits can be set for
+var outboundUpstreams = []string{"auth", "user", "admin"}
+
+// OutboundConfig holds the caps on traffic the gateway forwards to each upstream
+type OutboundConfig struct {
+	Enabled   bool
+	Upstreams map[string]UpstreamLimitConfig // Keyed by upstream: auth, user or admin
+}
+
+// UpstreamLimitConfig caps the traffic forwarded to one upstream. Requests over
+// the caps wait in a bounded queue for capacity.
+type UpstreamLimitConfig struct {
+	Rate          float64       // Requests per second forwarded; zero means unlimited
+	Burst         int           // Requests that may be forwarded at once after an idle period; defaults to the rate
+	MaxConcurrent int           // Requests in flight to the upstream; zero means unlimited
+	QueueSize     int           // Requests that may wait for capacity; zero rejects at once
+	QueueTimeout  time.Duration // How long a request may wait before it is rejected
+}
+
+// EntitlementsConfig holds subscription plan entitlements for premium features
+type EntitlementsConfig struct {
+	Enabled     bool
+	File        string // JSON file mapping plans to daily feature limits
+	PlanClaim   string // Token claim naming the caller's plan
+	DefaultPlan string // Plan for tokens without the claim
+	Timezone    string // IANA zone whose midnight resets the daily counters
+	KeyPrefix   string // Redis key prefix for usage counters
+}
+
+// VerificationConfig holds account verification gating for protected user routes
+type VerificationConfig struct {
+	Enabled        bool
+	RequiredClaims []string // Claims that must be true, e.g. email_verified, phone_verified
+	ExemptRoutes   []string // Routes unverified accounts may still call
+}
+
+// RolesConfig holds the role hierarchy
+type RolesConfig struct {
+	Hierarchy []string // "parent>child" entries; parent inherits every permission of child
+}
+
+// ImpersonationConfig holds admin impersonation settings
+type ImpersonationConfig struct {
+	Enabled       bool
+	TTL           time.Duration // Lifetime of impersonation tokens
+	Roles         []string      // Roles granted to impersonation tokens
+	BlockedRoutes []string      // Routes that cannot be called while impersonating
+}
+
+// AuditConfig holds audit log settings
+type AuditConfig struct {
+	File string // JSON lines audit file; empty writes audit events to the application log
+}
+
+// ChallengeConfig holds bot challenge (CAPTCHA) verification settings
+type ChallengeConfig struct {
+	Enabled        bool
+	Provider       string        // hcaptcha, recaptcha, turnstile or fake
+	Secret         string        // Provider secret; for the fake provider the accepted token
+	VerifyURL      string        // Overrides the provider's siteverify endpoint
+	Timeout        time.Duration // Timeout of verification requests
+	Header         string        // Request header carrying the token
+	BodyField      string        // JSON body field carrying the token when the header is absent
+	MinScore       float64       // Minimum score for providers that return one
+	RequiredRoutes []string      // Routes that cannot be used without a passed challenge
+	ResultHeader   string        // Header telling the upstream the verification outcome
+}
+
+// LoginProtectionConfig holds brute-force protection settings for the login route
+type LoginProtectionConfig struct {
+	Enabled                 bool
+	KeyPrefix               string        // Redis key prefix for counters and lockouts
+	IdentifierFields        []string      // Login body fields identifying the account, first non-empty wins
+	FailureStatuses         []int         // auth-service status codes that count as a failed login
+	Window                  time.Duration // How long failures are remembered
+	AccountLockoutThreshold int           // Failures per account before a lockout; zero disables
+	IPLockoutThreshold      int           // Failures per IP before a lockout; zero disables
+	LockoutDuration         time.Duration
+	DelayAfter              int           // Failures before attempts are delayed; zero disables
+	DelayBase               time.Duration // First delay, doubled with every further failure
+	DelayMax                time.Duration
+	ChallengeAfter          int // Failures before a verified challenge is required; zero disables
+}
+
+// IPFilterConfig holds the CIDR allow and deny list configuration
+type IPFilterConfig struct {
+	Enabled        bool
+	File           string        // JSON file with the global and per-group lists
+	ReloadInterval time.Duration // How often the file is checked for changes; zero disables reloading
+}
+
+// ClientIPConfig holds how the client address is resolved behind proxies
+type ClientIPConfig struct {
+	TrustedProxies   []string // CIDRs or addresses of proxies whose client IP headers are believed
+	Headers          []string // Headers carrying the client address, checked in order: X-Forwarded-For, X-Real-IP, CF-Connecting-IP
+	IPv6PrefixLength int      // IPv6 clients in the same prefix share rate limit and login counters
+}
+
+// StepUpConfig holds the step-up authentication requirement for sensitive admin routes
+type StepUpConfig struct {
+	Enabled   bool
+	ACRValues []string      // Accepted acr values, e.g. "mfa"
+	AMRValues []string      // Accepted amr methods, e.g. "otp", "hwk"
+	MaxAge    time.Duration // Maximum age of the authentication (auth_time)
+}
+
+// IntrospectionConfig holds OAuth2 token introspection (RFC 7662) configuration
+type IntrospectionConfig struct {
+	Mode             string // "jwt" (local only), "introspection" (always) or "hybrid" (opaque tokens only)
+	URL              string // Introspection endpoint
+	ClientID         string // Credentials the gateway presents to the endpoint
+	ClientSecret     string
+	Timeout          time.Duration // Timeout of each introspection call
+	MaxCacheTTL      time.Duration // Upper bound for caching active tokens, which are otherwise cached until exp
+	NegativeCacheTTL time.Duration // How long inactive tokens are cached
+}
+
+// IdentityConfig holds the configuration of the signed identity token forwarded to upstreams
+type IdentityConfig struct {
+	Enabled       bool
+	Header        string        // Header carrying the identity token to upstreams
+	Secret        string        // HMAC key shared with the upstream services
+	Issuer        string        // iss claim of the identity token
+	Audience      string        // aud claim of the identity token
+	TTL           time.Duration // Lifetime of each identity token
+	LegacyHeaders bool          // Keep sending the X-User-ID, X-Username and X-User-Role headers
+}
+
+// OwnershipConfig holds resource ownership check configuration
+type OwnershipConfig struct {
+	OverrideRoles []string // Roles that may access any user's resources
+}
+
+// PolicyConfig holds the policy-based authorization configuration
+type PolicyConfig struct {
+	Enabled bool
+	File    string // JSON policy file mapping routes to rules
+	DryRun  bool   // Log decisions without enforcing them
+}
+
+// OIDCConfig holds OpenID Connect social login configuration
+type OIDCConfig struct {
+	Enabled         bool
+	ProvidersFile   string        // JSON file describing the configured providers
+	StateSecret     string        // Key used to sign the login state cookie
+	StateCookieName string        // Cookie carrying state, nonce and PKCE verifier between redirect and callback
+	StateTTL        time.Duration // Time allowed to complete the provider login
+	CookieSameSite  string        // "lax" for redirects, "none" for providers using form_post
+	LinkPath        string        // auth-service endpoint that links or creates the account
+	HTTPTimeout     time.Duration // Timeout for provider and auth-service calls
+}
+
+// APIKeyConfig holds API key authentication configuration for partner integrations
+type APIKeyConfig struct {
+	Enabled     bool
+	Header      string // Header carrying the API key
+	Store       string // "file" or "redis"
+	File        string // Path to the JSON key file when Store is "file"
+	RedisPrefix string // Key prefix when Store is "redis"
+}
+
+// SessionConfig holds cookie-based session configuration for the web frontend
+type SessionConfig struct {
+	CookieMode        bool   // Issue tokens as HttpOnly cookies on login and accept them on protected routes
+	AccessCookieName  string // Cookie holding the access token
+	RefreshCookieName string // Cookie holding the refresh token
+	CSRFCookieName    string // Cookie holding the CSRF token (double-submit mode only)
+	CookieDomain      string
+	CookiePath        string
+	RefreshCookiePath string // The refresh token is only sent to the refresh route
+	CookieSecure      bool
+	CookieSameSite    string // "strict", "lax" or "none"
+	StripTokens       bool   // Remove the access token from the login response body once it is set as a cookie
+	CSRFMode          string // "double_submit" or "synchronizer"
+	CSRFSecret        string // Key used to derive synchronizer tokens; must differ from the JWT secret
 }
 
 // RateLimitingConfig holds rate limiting configuration
@@ -23,7 +273,20 @@ type RateLimitingConfig struct {
 	Limit        int           // Requests per time window
 	Burst        int           // Maximum burst size
 	Window       time.Duration // Time window for rate limiting
-	RedisAddress string        // Redis address for rate limiting
+	PoliciesFile string        // Optional JSON file with per-route rate limit policies
+
+	Algorithm          string        // Default counting algorithm: gcra, fixed_window, sliding_log or sliding_window
+	FailureMode        string        // What policies do while Redis is down: memory, open or closed
+	Headers            string        // Response headers: legacy (X-RateLimit-*), ietf (RateLimit, RateLimit-Policy) or both
+	OverrideMaxTTL     time.Duration // Longest exemption or raised limit the admin API may grant
+	RedisCheckInterval time.Duration // How often Redis is pinged while it is down
+
+	// Per-IP limit applied before authentication and on the health endpoints,
+	// so bad tokens and API key guessing are throttled too
+	PreAuthEnabled bool
+	PreAuthLimit   int
+	PreAuthBurst   int
+	PreAuthWindow  time.Duration
 }
 
 // JWTConfig holds JWT-related configuration
@@ -86,6 +349,193 @@ func validateConfig(cfg *Config) error {
 		return fmt.Errorf("ADMIN_SERVICE_URL environment variable is required")
 	}
 
+	// Validate session configuration
+	if cfg.Session.CookieMode {
+		switch cfg.Session.CSRFMode {
+		case "double_submit", "synchronizer":
+		default:
+			return fmt.Errorf("SESSION_CSRF_MODE must be one of double_submit, synchronizer")
+		}
+		switch cfg.Session.CookieSameSite {
+		case "strict", "lax", "none":
+		default:
+			return fmt.Errorf("SESSION_COOKIE_SAMESITE must be one of strict, lax, none")
+		}
+		if cfg.Session.CSRFSecret == "" {
+			return fmt.Errorf("SESSION_CSRF_SECRET is required when SESSION_COOKIE_MODE is true")
+		}
+		if cfg.Session.CSRFSecret == cfg.JWT.Secret {
+			return fmt.Errorf("SESSION_CSRF_SECRET must differ from JWT_SECRET")
+		}
+	}
+
+	// Validate API key configuration
+	if cfg.APIKeys.Enabled {
+		switch cfg.APIKeys.Store {
+		case "file":
+			if cfg.APIKeys.File == "" {
+				return fmt.Errorf("API_KEY_FILE is required when API_KEY_STORE is file")
+			}
+		case "redis":
+		default:
+			return fmt.Errorf("API_KEY_STORE must be one of file, redis")
+		}
+	}
+
+	// Validate Redis configuration
+	switch cfg.Redis.Mode {
+	case "standalone":
+		if cfg.Redis.Address == "" {
+			return fmt.Errorf("REDIS_ADDRESS is required when REDIS_MODE is standalone")
+		}
+	case "sentinel":
+		if len(cfg.Redis.Addresses) == 0 || cfg.Redis.MasterName == "" {
+			return fmt.Errorf("REDIS_ADDRESSES and REDIS_MASTER_NAME are required when REDIS_MODE is sentinel")
+		}
+	case "cluster":
+		if len(cfg.Redis.Addresses) == 0 {
+			return fmt.Errorf("REDIS_ADDRESSES is required when REDIS_MODE is cluster")
+		}
+		if cfg.Redis.DB != 0 {
+			return fmt.Errorf("REDIS_DB must be 0 when REDIS_MODE is cluster")
+		}
+	default:
+		return fmt.Errorf("REDIS_MODE must be one of standalone, sentinel, cluster")
+	}
+	if (cfg.Redis.TLSCertFile == "") != (cfg.Redis.TLSKeyFile == "") {
+		return fmt.Errorf("REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	}
+
+	// Validate rate limiting configuration
+	switch cfg.RateLimiting.Algorithm {
+	case "gcra", "fixed_window", "sliding_log", "sliding_window":
+	default:
+		return fmt.Errorf("RATE_LIMIT_ALGORITHM must be one of gcra, fixed_window, sliding_log, sliding_window")
+	}
+	switch cfg.RateLimiting.FailureMode {
+	case "memory", "open", "closed":
+	default:
+		return fmt.Errorf("RATE_LIMIT_FAILURE_MODE must be one of memory, open, closed")
+	}
+	switch cfg.RateLimiting.Headers {
+	case "legacy", "ietf", "both":
+	default:
+		return fmt.Errorf("RATE_LIMIT_HEADERS must be one of legacy, ietf, both")
+	}
+	if cfg.RateLimiting.PreAuthEnabled && (cfg.RateLimiting.PreAuthLimit <= 0 || cfg.RateLimiting.PreAuthWindow <= 0 || cfg.RateLimiting.PreAuthBurst < 0) {
+		return fmt.Errorf("RATE_LIMIT_PRE_AUTH_LIMIT and RATE_LIMIT_PRE_AUTH_WINDOW must be positive and RATE_LIMIT_PRE_AUTH_BURST must not be negative")
+	}
+
+	// Validate concurrency limiting configuration
+	if cfg.Concurrency.Enabled {
+		if cfg.Concurrency.MinLimit <= 0 ||
+			cfg.Concurrency.GlobalInitialLimit < cfg.Concurrency.MinLimit || cfg.Concurrency.GlobalMaxLimit < cfg.Concurrency.GlobalInitialLimit ||
+			cfg.Concurrency.UpstreamInitialLimit < cfg.Concurrency.MinLimit || cfg.Concurrency.UpstreamMaxLimit < cfg.Concurrency.UpstreamInitialLimit {
+			return fmt.Errorf("CONCURRENCY limits must satisfy 0 < MIN_LIMIT <= INITIAL_LIMIT <= MAX_LIMIT")
+		}
+		if cfg.Concurrency.BackoffRatio <= 0 || cfg.Concurrency.BackoffRatio >= 1 {
+			return fmt.Errorf("CONCURRENCY_BACKOFF_RATIO must be between 0 and 1")
+		}
+	}
+
+	// Validate outbound limit configuration
+	for name, limit := range cfg.Outbound.Upstreams {
+		if limit.Rate < 0 || limit.Burst < 0 || limit.MaxConcurrent < 0 || limit.QueueSize < 0 || limit.QueueTimeout < 0 {
+			return fmt.Errorf("OUTBOUND_%s limits must not be negative", strings.ToUpper(name))
+		}
+	}
+
+	// Validate OIDC configuration
+	if cfg.OIDC.Enabled {
+		if cfg.OIDC.ProvidersFile == "" {
+			return fmt.Errorf("OIDC_PROVIDERS_FILE is required when OIDC_ENABLED is true")
+		}
+		if cfg.OIDC.StateSecret == "" {
+			return fmt.Errorf("OIDC_STATE_SECRET is required when OIDC_ENABLED is true")
+		}
+		if cfg.OIDC.StateSecret == cfg.JWT.Secret {
+			return fmt.Errorf("OIDC_STATE_SECRET must differ from JWT_SECRET")
+		}
+		// The account link call is authenticated with an identity token
+		if !cfg.Identity.Enabled {
+			return fmt.Errorf("OIDC_ENABLED requires INTERNAL_IDENTITY_ENABLED to be true")
+		}
+	}
+
+	// Validate policy configuration
+	if cfg.Policy.Enabled && cfg.Policy.File == "" {
+		return fmt.Errorf("POLICY_FILE is required when POLICY_ENABLED is true")
+	}
+
+	// Validate entitlements configuration
+	if cfg.Entitlements.Enabled && cfg.Entitlements.File == "" {
+		return fmt.Errorf("ENTITLEMENTS_FILE is required when ENTITLEMENTS_ENABLED is true")
+	}
+
+	// Validate IP filter configuration
+	if cfg.IPFilter.Enabled && cfg.IPFilter.File == "" {
+		return fmt.Errorf("IP_FILTER_FILE is required when IP_FILTER_ENABLED is true")
+	}
+
+	// Validate client IP configuration
+	for _, proxy := range cfg.ClientIP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("TRUSTED_PROXIES contains an invalid CIDR or address %q", proxy)
+		}
+	}
+	for _, header := range cfg.ClientIP.Headers {
+		switch strings.ToLower(header) {
+		case "x-forwarded-for", "x-real-ip", "cf-connecting-ip":
+		default:
+			return fmt.Errorf("CLIENT_IP_HEADERS must only contain X-Forwarded-For, X-Real-IP, CF-Connecting-IP")
+		}
+	}
+	if cfg.ClientIP.IPv6PrefixLength < 1 || cfg.ClientIP.IPv6PrefixLength > 128 {
+		return fmt.Errorf("CLIENT_IP_IPV6_PREFIX_LENGTH must be between 1 and 128")
+	}
+
+	// Validate challenge configuration
+	if cfg.Challenge.Enabled {
+		switch cfg.Challenge.Provider {
+		case "hcaptcha", "recaptcha", "turnstile", "fake":
+		default:
+			return fmt.Errorf("CHALLENGE_PROVIDER must be one of hcaptcha, recaptcha, turnstile, fake")
+		}
+		if cfg.Challenge.Secret == "" {
+			return fmt.Errorf("CHALLENGE_SECRET is required when CHALLENGE_ENABLED is true")
+		}
+	}
+	if cfg.LoginProtection.Enabled && cfg.LoginProtection.ChallengeAfter > 0 && !cfg.Challenge.Enabled {
+		return fmt.Errorf("LOGIN_PROTECTION_CHALLENGE_AFTER requires CHALLENGE_ENABLED to be true")
+	}
+
+	// Validate impersonation configuration; impersonation tokens are gateway-signed JWTs
+	if cfg.Impersonation.Enabled && cfg.Introspection.Mode == "introspection" {
+		return fmt.Errorf("IMPERSONATION_ENABLED requires AUTH_TOKEN_MODE jwt or hybrid")
+	}
+
+	// Validate identity token configuration
+	if cfg.Identity.Enabled && cfg.Identity.Secret == "" {
+		return fmt.Errorf("INTERNAL_IDENTITY_SECRET is required when INTERNAL_IDENTITY_ENABLED is true")
+	}
+	if cfg.Identity.Enabled && cfg.Identity.Secret == cfg.JWT.Secret {
+		return fmt.Errorf("INTERNAL_IDENTITY_SECRET must differ from JWT_SECRET")
+	}
+	if cfg.Identity.Enabled && cfg.Identity.Issuer == cfg.JWT.Issuer {
+		return fmt.Errorf("INTERNAL_IDENTITY_ISSUER must differ from JWT_ISSUER")
+	}
+
+	// Validate token introspection configuration
+	switch cfg.Introspection.Mode {
+	case "jwt":
+	case "introspection", "hybrid":
+		if cfg.Introspection.URL == "" {
+			return fmt.Errorf("INTROSPECTION_URL is required when AUTH_TOKEN_MODE is %s", cfg.Introspection.Mode)
+		}
+	default:
+		return fmt.Errorf("AUTH_TOKEN_MODE must be one of jwt, introspection, hybrid")
+	}
+
 	return nil
 }
 
@@ -129,12 +579,194 @@ func NewConfig() (*Config, error) {
 			AllowCredentials: viper.GetBool("CORS_ALLOW_CREDENTIALS"),
 			MaxAge:           viper.GetDuration("CORS_MAX_AGE"),
 		},
+		Concurrency: ConcurrencyConfig{
+			Enabled:              viper.GetBool("CONCURRENCY_ENABLED"),
+			GlobalInitialLimit:   viper.GetInt("CONCURRENCY_GLOBAL_INITIAL_LIMIT"),
+			GlobalMaxLimit:       viper.GetInt("CONCURRENCY_GLOBAL_MAX_LIMIT"),
+			UpstreamInitialLimit: viper.GetInt("CONCURRENCY_UPSTREAM_INITIAL_LIMIT"),
+			UpstreamMaxLimit:     viper.GetInt("CONCURRENCY_UPSTREAM_MAX_LIMIT"),
+			MinLimit:             viper.GetInt("CONCURRENCY_MIN_LIMIT"),
+			LatencyTarget:        viper.GetDuration("CONCURRENCY_LATENCY_TARGET"),
+			BackoffRatio:         viper.GetFloat64("CONCURRENCY_BACKOFF_RATIO"),
+			AnonymousShare:       viper.GetFloat64("CONCURRENCY_ANONYMOUS_SHARE"),
+			AuthenticatedShare:   viper.GetFloat64("CONCURRENCY_AUTHENTICATED_SHARE"),
+			HighPriorityRoutes:   viper.GetStringSlice("CONCURRENCY_HIGH_PRIORITY_ROUTES"),
+			RetryAfter:           viper.GetDuration("CONCURRENCY_RETRY_AFTER"),
+		},
+		Outbound: OutboundConfig{
+			Enabled:   viper.GetBool("OUTBOUND_LIMITS_ENABLED"),
+			Upstreams: outboundLimits(),
+		},
+		Redis: RedisConfig{
+			Mode:             viper.GetString("REDIS_MODE"),
+			Address:          viper.GetString("REDIS_ADDRESS"),
+			Addresses:        viper.GetStringSlice("REDIS_ADDRESSES"),
+			MasterName:       viper.GetString("REDIS_MASTER_NAME"),
+			Username:         viper.GetString("REDIS_USERNAME"),
+			Password:         viper.GetString("REDIS_PASSWORD"),
+			SentinelUsername: viper.GetString("REDIS_SENTINEL_USERNAME"),
+			SentinelPassword: viper.GetString("REDIS_SENTINEL_PASSWORD"),
+			DB:               viper.GetInt("REDIS_DB"),
+
+			TLSEnabled:            viper.GetBool("REDIS_TLS_ENABLED"),
+			TLSCAFile:             viper.GetString("REDIS_TLS_CA_FILE"),
+			TLSCertFile:           viper.GetString("REDIS_TLS_CERT_FILE"),
+			TLSKeyFile:            viper.GetString("REDIS_TLS_KEY_FILE"),
+			TLSServerName:         viper.GetString("REDIS_TLS_SERVER_NAME"),
+			TLSInsecureSkipVerify: viper.GetBool("REDIS_TLS_INSECURE_SKIP_VERIFY"),
+
+			PoolSize:     viper.GetInt("REDIS_POOL_SIZE"),
+			MinIdleConns: viper.GetInt("REDIS_MIN_IDLE_CONNS"),
+			MaxRetries:   viper.GetInt("REDIS_MAX_RETRIES"),
+			DialTimeout:  viper.GetDuration("REDIS_DIAL_TIMEOUT"),
+			ReadTimeout:  viper.GetDuration("REDIS_READ_TIMEOUT"),
+			WriteTimeout: viper.GetDuration("REDIS_WRITE_TIMEOUT"),
+			PoolTimeout:  viper.GetDuration("REDIS_POOL_TIMEOUT"),
+		},
+		Readiness: ReadinessConfig{
+			RequireRedis: viper.GetBool("READINESS_REQUIRE_REDIS"),
+		},
 		RateLimiting: RateLimitingConfig{
 			Enabled:      viper.GetBool("RATE_LIMIT_ENABLED"),
 			Limit:        viper.GetInt("RATE_LIMIT"),
 			Burst:        viper.GetInt("RATE_LIMIT_BURST"),
 			Window:       viper.GetDuration("RATE_LIMIT_WINDOW"),
-			RedisAddress: viper.GetString("REDIS_ADDRESS"),
+			PoliciesFile: viper.GetString("RATE_LIMIT_POLICIES_FILE"),
+
+			Algorithm:          viper.GetString("RATE_LIMIT_ALGORITHM"),
+			FailureMode:        viper.GetString("RATE_LIMIT_FAILURE_MODE"),
+			Headers:            viper.GetString("RATE_LIMIT_HEADERS"),
+			OverrideMaxTTL:     viper.GetDuration("RATE_LIMIT_OVERRIDE_MAX_TTL"),
+			RedisCheckInterval: viper.GetDuration("RATE_LIMIT_REDIS_CHECK_INTERVAL"),
+
+			PreAuthEnabled: viper.GetBool("RATE_LIMIT_PRE_AUTH_ENABLED"),
+			PreAuthLimit:   viper.GetInt("RATE_LIMIT_PRE_AUTH_LIMIT"),
+			PreAuthBurst:   viper.GetInt("RATE_LIMIT_PRE_AUTH_BURST"),
+			PreAuthWindow:  viper.GetDuration("RATE_LIMIT_PRE_AUTH_WINDOW"),
+		},
+		Session: SessionConfig{
+			CookieMode:        viper.GetBool("SESSION_COOKIE_MODE"),
+			AccessCookieName:  viper.GetString("SESSION_ACCESS_COOKIE_NAME"),
+			RefreshCookieName: viper.GetString("SESSION_REFRESH_COOKIE_NAME"),
+			CSRFCookieName:    viper.GetString("SESSION_CSRF_COOKIE_NAME"),
+			CookieDomain:      viper.GetString("SESSION_COOKIE_DOMAIN"),
+			CookiePath:        viper.GetString("SESSION_COOKIE_PATH"),
+			RefreshCookiePath: viper.GetString("SESSION_REFRESH_COOKIE_PATH"),
+			CookieSecure:      viper.GetBool("SESSION_COOKIE_SECURE"),
+			CookieSameSite:    viper.GetString("SESSION_COOKIE_SAMESITE"),
+			StripTokens:       viper.GetBool("SESSION_STRIP_TOKENS"),
+			CSRFMode:          viper.GetString("SESSION_CSRF_MODE"),
+			CSRFSecret:        viper.GetString("SESSION_CSRF_SECRET"),
+		},
+		APIKeys: APIKeyConfig{
+			Enabled:     viper.GetBool("API_KEY_ENABLED"),
+			Header:      viper.GetString("API_KEY_HEADER"),
+			Store:       viper.GetString("API_KEY_STORE"),
+			File:        viper.GetString("API_KEY_FILE"),
+			RedisPrefix: viper.GetString("API_KEY_REDIS_PREFIX"),
+		},
+		OIDC: OIDCConfig{
+			Enabled:         viper.GetBool("OIDC_ENABLED"),
+			ProvidersFile:   viper.GetString("OIDC_PROVIDERS_FILE"),
+			StateSecret:     viper.GetString("OIDC_STATE_SECRET"),
+			StateCookieName: viper.GetString("OIDC_STATE_COOKIE_NAME"),
+			StateTTL:        viper.GetDuration("OIDC_STATE_TTL"),
+			CookieSameSite:  viper.GetString("OIDC_COOKIE_SAMESITE"),
+			LinkPath:        viper.GetString("OIDC_LINK_PATH"),
+			HTTPTimeout:     viper.GetDuration("OIDC_HTTP_TIMEOUT"),
+		},
+		Policy: PolicyConfig{
+			Enabled: viper.GetBool("POLICY_ENABLED"),
+			File:    viper.GetString("POLICY_FILE"),
+			DryRun:  viper.GetBool("POLICY_DRY_RUN"),
+		},
+		Ownership: OwnershipConfig{
+			OverrideRoles: viper.GetStringSlice("OWNERSHIP_OVERRIDE_ROLES"),
+		},
+		Identity: IdentityConfig{
+			Enabled:       viper.GetBool("INTERNAL_IDENTITY_ENABLED"),
+			Header:        viper.GetString("INTERNAL_IDENTITY_HEADER"),
+			Secret:        viper.GetString("INTERNAL_IDENTITY_SECRET"),
+			Issuer:        viper.GetString("INTERNAL_IDENTITY_ISSUER"),
+			Audience:      viper.GetString("INTERNAL_IDENTITY_AUDIENCE"),
+			TTL:           viper.GetDuration("INTERNAL_IDENTITY_TTL"),
+			LegacyHeaders: viper.GetBool("INTERNAL_IDENTITY_LEGACY_HEADERS"),
+		},
+		Introspection: IntrospectionConfig{
+			Mode:             viper.GetString("AUTH_TOKEN_MODE"),
+			URL:              viper.GetString("INTROSPECTION_URL"),
+			ClientID:         viper.GetString("INTROSPECTION_CLIENT_ID"),
+			ClientSecret:     viper.GetString("INTROSPECTION_CLIENT_SECRET"),
+			Timeout:          viper.GetDuration("INTROSPECTION_TIMEOUT"),
+			MaxCacheTTL:      viper.GetDuration("INTROSPECTION_CACHE_TTL"),
+			NegativeCacheTTL: viper.GetDuration("INTROSPECTION_NEGATIVE_CACHE_TTL"),
+		},
+		StepUp: StepUpConfig{
+			Enabled:   viper.GetBool("STEP_UP_ENABLED"),
+			ACRValues: viper.GetStringSlice("STEP_UP_ACR_VALUES"),
+			AMRValues: viper.GetStringSlice("STEP_UP_AMR_VALUES"),
+			MaxAge:    viper.GetDuration("STEP_UP_MAX_AGE"),
+		},
+		IPFilter: IPFilterConfig{
+			Enabled:        viper.GetBool("IP_FILTER_ENABLED"),
+			File:           viper.GetString("IP_FILTER_FILE"),
+			ReloadInterval: viper.GetDuration("IP_FILTER_RELOAD_INTERVAL"),
+		},
+		ClientIP: ClientIPConfig{
+			TrustedProxies:   trustedProxies(),
+			Headers:          viper.GetStringSlice("CLIENT_IP_HEADERS"),
+			IPv6PrefixLength: viper.GetInt("CLIENT_IP_IPV6_PREFIX_LENGTH"),
+		},
+		LoginProtection: LoginProtectionConfig{
+			Enabled:                 viper.GetBool("LOGIN_PROTECTION_ENABLED"),
+			KeyPrefix:               viper.GetString("LOGIN_PROTECTION_KEY_PREFIX"),
+			IdentifierFields:        viper.GetStringSlice("LOGIN_PROTECTION_IDENTIFIER_FIELDS"),
+			FailureStatuses:         viper.GetIntSlice("LOGIN_PROTECTION_FAILURE_STATUSES"),
+			Window:                  viper.GetDuration("LOGIN_PROTECTION_WINDOW"),
+			AccountLockoutThreshold: viper.GetInt("LOGIN_PROTECTION_ACCOUNT_LOCKOUT_THRESHOLD"),
+			IPLockoutThreshold:      viper.GetInt("LOGIN_PROTECTION_IP_LOCKOUT_THRESHOLD"),
+			LockoutDuration:         viper.GetDuration("LOGIN_PROTECTION_LOCKOUT_DURATION"),
+			DelayAfter:              viper.GetInt("LOGIN_PROTECTION_DELAY_AFTER"),
+			DelayBase:               viper.GetDuration("LOGIN_PROTECTION_DELAY_BASE"),
+			DelayMax:                viper.GetDuration("LOGIN_PROTECTION_DELAY_MAX"),
+			ChallengeAfter:          viper.GetInt("LOGIN_PROTECTION_CHALLENGE_AFTER"),
+		},
+		Challenge: ChallengeConfig{
+			Enabled:        viper.GetBool("CHALLENGE_ENABLED"),
+			Provider:       viper.GetString("CHALLENGE_PROVIDER"),
+			Secret:         viper.GetString("CHALLENGE_SECRET"),
+			VerifyURL:      viper.GetString("CHALLENGE_VERIFY_URL"),
+			Timeout:        viper.GetDuration("CHALLENGE_TIMEOUT"),
+			Header:         viper.GetString("CHALLENGE_HEADER"),
+			BodyField:      viper.GetString("CHALLENGE_BODY_FIELD"),
+			MinScore:       viper.GetFloat64("CHALLENGE_MIN_SCORE"),
+			RequiredRoutes: viper.GetStringSlice("CHALLENGE_REQUIRED_ROUTES"),
+			ResultHeader:   viper.GetString("CHALLENGE_RESULT_HEADER"),
+		},
+		Impersonation: ImpersonationConfig{
+			Enabled:       viper.GetBool("IMPERSONATION_ENABLED"),
+			TTL:           viper.GetDuration("IMPERSONATION_TTL"),
+			Roles:         viper.GetStringSlice("IMPERSONATION_ROLES"),
+			BlockedRoutes: viper.GetStringSlice("IMPERSONATION_BLOCKED_ROUTES"),
+		},
+		Audit: AuditConfig{
+			File: viper.GetString("AUDIT_LOG_FILE"),
+		},
+		Roles: RolesConfig{
+			Hierarchy: viper.GetStringSlice("ROLE_HIERARCHY"),
+		},
+		Verification: VerificationConfig{
+			Enabled:        viper.GetBool("VERIFICATION_ENABLED"),
+			RequiredClaims: viper.GetStringSlice("VERIFICATION_REQUIRED_CLAIMS"),
+			ExemptRoutes:   viper.GetStringSlice("VERIFICATION_EXEMPT_ROUTES"),
+		},
+		Entitlements: EntitlementsConfig{
+			Enabled:     viper.GetBool("ENTITLEMENTS_ENABLED"),
+			File:        viper.GetString("ENTITLEMENTS_FILE"),
+			PlanClaim:   viper.GetString("ENTITLEMENTS_PLAN_CLAIM"),
+			DefaultPlan: viper.GetString("ENTITLEMENTS_DEFAULT_PLAN"),
+			Timezone:    viper.GetString("ENTITLEMENTS_TIMEZONE"),
+			KeyPrefix:   viper.GetString("ENTITLEMENTS_KEY_PREFIX"),
 		},
 	}
 
@@ -146,6 +778,31 @@ func NewConfig() (*Config, error) {
 	return config, nil
 }
 
+// outboundLimits reads the OUTBOUND_<UPSTREAM>_* limits of every upstream
+func outboundLimits() map[string]UpstreamLimitConfig {
+	limits := make(map[string]UpstreamLimitConfig, len(outboundUpstreams))
+	for _, name := range outboundUpstreams {
+		prefix := "OUTBOUND_" + strings.ToUpper(name) + "_"
+		limits[name] = UpstreamLimitConfig{
+			Rate:          viper.GetFloat64(prefix + "RATE"),
+			Burst:         viper.GetInt(prefix + "BURST"),
+			MaxConcurrent: viper.GetInt(prefix + "MAX_CONCURRENT"),
+			QueueSize:     viper.GetInt(prefix + "QUEUE_SIZE"),
+			QueueTimeout:  viper.GetDuration(prefix + "QUEUE_TIMEOUT"),
+		}
+	}
+	return limits
+}
+
+// trustedProxies reads TRUSTED_PROXIES, where "none" or no value trusts no proxy
+func trustedProxies() []string {
+	proxies := viper.GetStringSlice("TRUSTED_PROXIES")
+	if len(proxies) == 1 && strings.EqualFold(proxies[0], "none") {
+		return []string{}
+	}
+	return proxies
+}
+
 // setDefaults configures all the default values
 func setDefaults() {
 	// Server defaults
@@ -177,18 +834,205 @@ func setDefaults() {
 	})
 	viper.SetDefault("CORS_ALLOW_HEADERS", []string{
 		"Origin", "Content-Type", "Accept", "Authorization", "X-Request-ID",
-		"X-User-ID", "X-User-Role", "X-Username", // Adding our identity propagation headers
+		"X-CSRF-Token", "X-API-Key", "X-Challenge-Token",
 	})
 	viper.SetDefault("CORS_EXPOSE_HEADERS", []string{
-		"Content-Length", "X-Request-ID",
+		"Content-Length", "X-Request-ID", "X-CSRF-Token",
+		"X-Quota-Limit", "X-Quota-Remaining", "X-Quota-Reset", "Retry-After",
+		"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "RateLimit", "RateLimit-Policy",
 	})
 	viper.SetDefault("CORS_ALLOW_CREDENTIALS", true)
 	viper.SetDefault("CORS_MAX_AGE", 12*time.Hour)
 
+	// Redis defaults - one standalone server without authentication
+	viper.SetDefault("REDIS_MODE", "standalone")
+	viper.SetDefault("REDIS_ADDRESS", "redis:6379")
+	viper.SetDefault("REDIS_ADDRESSES", []string{})
+	viper.SetDefault("REDIS_MASTER_NAME", "")
+	viper.SetDefault("REDIS_USERNAME", "")
+	viper.SetDefault("REDIS_PASSWORD", "")
+	viper.SetDefault("REDIS_SENTINEL_USERNAME", "")
+	viper.SetDefault("REDIS_SENTINEL_PASSWORD", "")
+	viper.SetDefault("REDIS_DB", 0)
+	viper.SetDefault("REDIS_TLS_ENABLED", false)
+	viper.SetDefault("REDIS_TLS_CA_FILE", "")
+	viper.SetDefault("REDIS_TLS_CERT_FILE", "")
+	viper.SetDefault("REDIS_TLS_KEY_FILE", "")
+	viper.SetDefault("REDIS_TLS_SERVER_NAME", "")
+	viper.SetDefault("REDIS_TLS_INSECURE_SKIP_VERIFY", false)
+	viper.SetDefault("REDIS_POOL_SIZE", 0)
+	viper.SetDefault("REDIS_MIN_IDLE_CONNS", 0)
+	viper.SetDefault("REDIS_MAX_RETRIES", 3)
+	viper.SetDefault("REDIS_DIAL_TIMEOUT", 5*time.Second)
+	viper.SetDefault("REDIS_READ_TIMEOUT", 3*time.Second)
+	viper.SetDefault("REDIS_WRITE_TIMEOUT", 3*time.Second)
+	viper.SetDefault("REDIS_POOL_TIMEOUT", 4*time.Second)
+	viper.SetDefault("READINESS_REQUIRE_REDIS", true)
+
 	// Rate limiting defaults - simplified to only use Redis
 	viper.SetDefault("RATE_LIMIT_ENABLED", true)
 	viper.SetDefault("RATE_LIMIT", 100)
 	viper.SetDefault("RATE_LIMIT_BURST", 150)
 	viper.SetDefault("RATE_LIMIT_WINDOW", time.Minute)
-	viper.SetDefault("REDIS_ADDRESS", "redis:6379")
+	viper.SetDefault("RATE_LIMIT_POLICIES_FILE", "")
+	viper.SetDefault("RATE_LIMIT_ALGORITHM", "gcra")
+	viper.SetDefault("RATE_LIMIT_FAILURE_MODE", "memory")
+	viper.SetDefault("RATE_LIMIT_HEADERS", "legacy")
+	viper.SetDefault("RATE_LIMIT_OVERRIDE_MAX_TTL", 7*24*time.Hour)
+	viper.SetDefault("RATE_LIMIT_REDIS_CHECK_INTERVAL", 5*time.Second)
+	viper.SetDefault("RATE_LIMIT_PRE_AUTH_ENABLED", true)
+	viper.SetDefault("RATE_LIMIT_PRE_AUTH_LIMIT", 300)
+	viper.SetDefault("RATE_LIMIT_PRE_AUTH_BURST", 0) // Defaults to the limit
+	viper.SetDefault("RATE_LIMIT_PRE_AUTH_WINDOW", time.Minute)
+
+	// Concurrency limiting defaults - anonymous traffic is shed first
+	viper.SetDefault("CONCURRENCY_ENABLED", false)
+	viper.SetDefault("CONCURRENCY_GLOBAL_INITIAL_LIMIT", 200)
+	viper.SetDefault("CONCURRENCY_GLOBAL_MAX_LIMIT", 2000)
+	viper.SetDefault("CONCURRENCY_UPSTREAM_INITIAL_LIMIT", 50)
+	viper.SetDefault("CONCURRENCY_UPSTREAM_MAX_LIMIT", 500)
+	viper.SetDefault("CONCURRENCY_MIN_LIMIT", 10)
+	viper.SetDefault("CONCURRENCY_LATENCY_TARGET", time.Second)
+	viper.SetDefault("CONCURRENCY_BACKOFF_RATIO", 0.9)
+	viper.SetDefault("CONCURRENCY_ANONYMOUS_SHARE", 0.5)
+	viper.SetDefault("CONCURRENCY_AUTHENTICATED_SHARE", 0.9)
+	viper.SetDefault("CONCURRENCY_HIGH_PRIORITY_ROUTES", []string{
+		"POST /api/v1/auth/login", "POST /api/v1/users/*/interests",
+	})
+	viper.SetDefault("CONCURRENCY_RETRY_AFTER", 2*time.Second)
+
+	// Outbound limit defaults - no caps until an upstream's capacity is configured
+	viper.SetDefault("OUTBOUND_LIMITS_ENABLED", false)
+	for _, name := range outboundUpstreams {
+		prefix := "OUTBOUND_" + strings.ToUpper(name) + "_"
+		viper.SetDefault(prefix+"RATE", 0)
+		viper.SetDefault(prefix+"BURST", 0)
+		viper.SetDefault(prefix+"MAX_CONCURRENT", 0)
+		viper.SetDefault(prefix+"QUEUE_SIZE", 100)
+		viper.SetDefault(prefix+"QUEUE_TIMEOUT", time.Second)
+	}
+
+	// Session defaults - cookie mode is opt-in for the web frontend
+	viper.SetDefault("SESSION_COOKIE_MODE", false)
+	viper.SetDefault("SESSION_ACCESS_COOKIE_NAME", "qk_access_token")
+	viper.SetDefault("SESSION_REFRESH_COOKIE_NAME", "qk_refresh_token")
+	viper.SetDefault("SESSION_CSRF_COOKIE_NAME", "qk_csrf_token")
+	viper.SetDefault("SESSION_COOKIE_DOMAIN", "")
+	viper.SetDefault("SESSION_COOKIE_PATH", "/")
+	viper.SetDefault("SESSION_REFRESH_COOKIE_PATH", "/api/v1/auth/refresh")
+	viper.SetDefault("SESSION_COOKIE_SECURE", true)
+	viper.SetDefault("SESSION_COOKIE_SAMESITE", "strict")
+	viper.SetDefault("SESSION_STRIP_TOKENS", false)
+	viper.SetDefault("SESSION_CSRF_MODE", "double_submit")
+
+	// API key defaults - partner access is opt-in
+	viper.SetDefault("API_KEY_ENABLED", false)
+	viper.SetDefault("API_KEY_HEADER", "X-API-Key")
+	viper.SetDefault("API_KEY_STORE", "file")
+	viper.SetDefault("API_KEY_FILE", "")
+	viper.SetDefault("API_KEY_REDIS_PREFIX", "apikey:")
+
+	// OIDC defaults - social login is opt-in
+	viper.SetDefault("OIDC_ENABLED", false)
+	viper.SetDefault("OIDC_PROVIDERS_FILE", "")
+	viper.SetDefault("OIDC_STATE_COOKIE_NAME", "qk_oidc_state")
+	viper.SetDefault("OIDC_STATE_TTL", 10*time.Minute)
+	viper.SetDefault("OIDC_COOKIE_SAMESITE", "lax")
+	viper.SetDefault("OIDC_LINK_PATH", "/auth/oidc/link")
+	viper.SetDefault("OIDC_HTTP_TIMEOUT", 10*time.Second)
+
+	// Policy defaults
+	viper.SetDefault("POLICY_ENABLED", false)
+	viper.SetDefault("POLICY_FILE", "")
+	viper.SetDefault("POLICY_DRY_RUN", false)
+
+	// Ownership defaults
+	viper.SetDefault("OWNERSHIP_OVERRIDE_ROLES", []string{"admin", "moderator"})
+
+	// Internal identity token defaults
+	viper.SetDefault("INTERNAL_IDENTITY_ENABLED", false)
+	viper.SetDefault("INTERNAL_IDENTITY_HEADER", "X-Internal-Identity")
+	viper.SetDefault("INTERNAL_IDENTITY_ISSUER", "qubool-kallyaanam-api-gateway")
+	viper.SetDefault("INTERNAL_IDENTITY_AUDIENCE", "qubool-kallyaanam-services")
+	viper.SetDefault("INTERNAL_IDENTITY_TTL", time.Minute)
+	viper.SetDefault("INTERNAL_IDENTITY_LEGACY_HEADERS", true)
+
+	// Token introspection defaults - local JWT validation unless configured otherwise
+	viper.SetDefault("AUTH_TOKEN_MODE", "jwt")
+	viper.SetDefault("INTROSPECTION_URL", "http://auth-service:8081/oauth/introspect")
+	viper.SetDefault("INTROSPECTION_TIMEOUT", 3*time.Second)
+	viper.SetDefault("INTROSPECTION_CACHE_TTL", 5*time.Minute)
+	viper.SetDefault("INTROSPECTION_NEGATIVE_CACHE_TTL", 10*time.Second)
+
+	// Step-up defaults - once enabled, sensitive admin actions need a recent MFA login
+	viper.SetDefault("STEP_UP_ENABLED", false)
+	viper.SetDefault("STEP_UP_ACR_VALUES", []string{"mfa"})
+	viper.SetDefault("STEP_UP_AMR_VALUES", []string{})
+	viper.SetDefault("STEP_UP_MAX_AGE", 15*time.Minute)
+
+	// IP filter defaults
+	viper.SetDefault("IP_FILTER_ENABLED", false)
+	viper.SetDefault("IP_FILTER_FILE", "")
+	viper.SetDefault("IP_FILTER_RELOAD_INTERVAL", 30*time.Second)
+
+	// Client IP defaults - trust forwarding headers from private networks only
+	viper.SetDefault("TRUSTED_PROXIES", []string{}) // trust no proxy until the deployment lists its own
+	viper.SetDefault("CLIENT_IP_HEADERS", []string{"X-Forwarded-For", "X-Real-IP"})
+	viper.SetDefault("CLIENT_IP_IPV6_PREFIX_LENGTH", 64)
+
+	// Login protection defaults
+	viper.SetDefault("LOGIN_PROTECTION_ENABLED", false)
+	viper.SetDefault("LOGIN_PROTECTION_KEY_PREFIX", "login:")
+	viper.SetDefault("LOGIN_PROTECTION_IDENTIFIER_FIELDS", []string{"email", "phone", "username"})
+	viper.SetDefault("LOGIN_PROTECTION_FAILURE_STATUSES", []int{401})
+	viper.SetDefault("LOGIN_PROTECTION_WINDOW", 15*time.Minute)
+	viper.SetDefault("LOGIN_PROTECTION_ACCOUNT_LOCKOUT_THRESHOLD", 10)
+	viper.SetDefault("LOGIN_PROTECTION_IP_LOCKOUT_THRESHOLD", 50)
+	viper.SetDefault("LOGIN_PROTECTION_LOCKOUT_DURATION", 15*time.Minute)
+	viper.SetDefault("LOGIN_PROTECTION_DELAY_AFTER", 3)
+	viper.SetDefault("LOGIN_PROTECTION_DELAY_BASE", 500*time.Millisecond)
+	viper.SetDefault("LOGIN_PROTECTION_DELAY_MAX", 8*time.Second)
+	viper.SetDefault("LOGIN_PROTECTION_CHALLENGE_AFTER", 0)
+
+	// Challenge verification defaults
+	viper.SetDefault("CHALLENGE_ENABLED", false)
+	viper.SetDefault("CHALLENGE_PROVIDER", "hcaptcha")
+	viper.SetDefault("CHALLENGE_SECRET", "")
+	viper.SetDefault("CHALLENGE_VERIFY_URL", "")
+	viper.SetDefault("CHALLENGE_TIMEOUT", 5*time.Second)
+	viper.SetDefault("CHALLENGE_HEADER", "X-Challenge-Token")
+	viper.SetDefault("CHALLENGE_BODY_FIELD", "captcha_token")
+	viper.SetDefault("CHALLENGE_MIN_SCORE", 0.5)
+	viper.SetDefault("CHALLENGE_REQUIRED_ROUTES", []string{"POST /api/v1/auth/register"})
+	viper.SetDefault("CHALLENGE_RESULT_HEADER", "X-Challenge-Result")
+
+	// Impersonation defaults
+	viper.SetDefault("IMPERSONATION_ENABLED", false)
+	viper.SetDefault("IMPERSONATION_TTL", 15*time.Minute)
+	viper.SetDefault("IMPERSONATION_ROLES", []string{"user"})
+	viper.SetDefault("IMPERSONATION_BLOCKED_ROUTES", []string{
+		"/api/v1/payments/*",
+		"/api/v1/auth/change-password",
+		"/api/v1/auth/logout",
+		"/api/v1/admin/*",
+	})
+
+	// Audit defaults
+	viper.SetDefault("AUDIT_LOG_FILE", "")
+
+	// Role hierarchy defaults - admins can do everything moderators can, moderators everything users can
+	viper.SetDefault("ROLE_HIERARCHY", []string{"admin>moderator", "moderator>user"})
+
+	// Verification gating defaults - unverified accounts may only read their profile
+	viper.SetDefault("VERIFICATION_ENABLED", false)
+	viper.SetDefault("VERIFICATION_REQUIRED_CLAIMS", []string{"email_verified"})
+	viper.SetDefault("VERIFICATION_EXEMPT_ROUTES", []string{"GET /api/v1/users/profile"})
+
+	// Entitlements defaults
+	viper.SetDefault("ENTITLEMENTS_ENABLED", false)
+	viper.SetDefault("ENTITLEMENTS_FILE", "")
+	viper.SetDefault("ENTITLEMENTS_PLAN_CLAIM", "plan")
+	viper.SetDefault("ENTITLEMENTS_DEFAULT_PLAN", "free")
+	viper.SetDefault("ENTITLEMENTS_TIMEZONE", "UTC")
+	viper.SetDefault("ENTITLEMENTS_KEY_PREFIX", "quota:")
 }
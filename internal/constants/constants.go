@@ -34,17 +34,104 @@ const (
 	ErrResourceNotFound   = "Resource not found"
 )
 
+// Machine-readable error codes returned in APIError details
+const (
+	ErrorCodeStepUpRequired    = "step_up_required"
+	ErrorCodeLoginLocked       = "login_locked"
+	ErrorCodeChallengeRequired = "challenge_required"
+	ErrorCodeChallengeFailed   = "challenge_failed"
+
+	ErrorCodeVerificationRequired = "verification_required"
+	ErrorCodePlanUpgradeRequired  = "plan_upgrade_required"
+	ErrorCodeQuotaExceeded        = "quota_exceeded"
+	ErrorCodeRateLimited          = "rate_limited"
+	ErrorCodeCostExceedsCapacity  = "cost_exceeds_capacity"
+	ErrorCodeOverloaded           = "overloaded"
+	ErrorCodeUpstreamBusy         = "upstream_busy"
+)
+
+// Upstream services, used to scope per-upstream limits
+const (
+	UpstreamAuth  = "auth"
+	UpstreamUser  = "user"
+	UpstreamAdmin = "admin"
+)
+
 // Authentication constants
 const (
 	// Roles
-	RoleAdmin = "admin"
-	RoleUser  = "user"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleUser      = "user"
+	RolePartner   = "partner"
+
+	// API key scopes required by the partner-accessible user routes
+	ScopeProfilesRead   = "profiles:read"
+	ScopeProfilesWrite  = "profiles:write"
+	ScopeContactsRead   = "contacts:read"
+	ScopeInterestsWrite = "interests:write"
+
+	// Authentication methods that can be enabled per route
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+
+	// Bearer tokens verified by the introspection endpoint instead of locally
+	AuthMethodIntrospection = "introspection"
+
+	// External identities verified by the gateway's social login, sent to auth-service to link an account
+	AuthMethodOIDC = "oidc"
 
 	// Context keys
 	ContextKeyUser = "user"
 
+	// Set to true once the request's bot challenge token has been verified
+	ContextKeyChallengeVerified = "challenge_verified"
+
+	// Latency and outcome of the upstream call, recorded by the handler that makes it
+	ContextKeyUpstreamResult = "upstream_result"
+
+	// Outbound limit of the route's upstream, acquired by the handler right before calling it
+	ContextKeyOutboundGate = "outbound_gate"
+
+	// Concurrency limits of the route's upstream and the request's priority, acquired like the outbound gate
+	ContextKeyLoadShedding = "load_shedding"
+
 	// Headers for propagating user identity
 	HeaderUserID   = "X-User-ID"
 	HeaderUserRole = "X-User-Role"
 	HeaderUsername = "X-Username"
+
+	// Header carrying the real admin's ID on impersonated requests
+	HeaderActorID = "X-Actor-ID"
+)
+
+// Session constants
+const (
+	// Header carrying the CSRF token on state-changing requests
+	HeaderCSRFToken = "X-CSRF-Token"
+
+	// CSRF protection modes
+	CSRFModeDoubleSubmit = "double_submit"
+	CSRFModeSynchronizer = "synchronizer"
+
+	// Token fields in the auth-service login response
+	FieldAccessToken  = "access_token"
+	FieldRefreshToken = "refresh_token"
+)
+
+// Audit actions
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditVerificationBypass   = "impersonation.verification_bypass"
+
+	AuditRateLimitReset          = "ratelimit.reset"
+	AuditRateLimitOverrideGrant  = "ratelimit.override.grant"
+	AuditRateLimitOverrideRevoke = "ratelimit.override.revoke"
+)
+
+// Premium features metered by subscription plan
+const (
+	FeatureContactView  = "contact_view"
+	FeatureInterestSend = "interest_send"
 )
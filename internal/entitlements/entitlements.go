@@ -0,0 +1,71 @@
+package entitlements
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Unlimited marks a feature without a daily limit
+const Unlimited = -1
+
+// Document is the entitlements file. It maps each plan to the daily limit of
+// every premium feature, for example:
+//
+//	{"plans": {"free": {"contact_view": 5}, "gold": {"contact_view": 50, "interest_send": -1}}}
+//
+// A feature missing from a plan is not included in it; -1 means unlimited.
+type Document struct {
+	Plans map[string]map[string]int `json:"plans"`
+}
+
+// Entitlement is what a plan grants for a feature
+type Entitlement struct {
+	Included  bool
+	Unlimited bool
+	Limit     int // Uses per day when not unlimited
+}
+
+// Catalog answers entitlement questions for a loaded document
+type Catalog struct {
+	doc Document
+}
+
+// LoadFile reads and validates an entitlements document from a JSON file
+func LoadFile(file string) (*Catalog, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entitlements file: %w", err)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse entitlements file: %w", err)
+	}
+	return NewCatalog(doc)
+}
+
+// NewCatalog validates a document and creates a catalog for it
+func NewCatalog(doc Document) (*Catalog, error) {
+	for plan, features := range doc.Plans {
+		for feature, limit := range features {
+			if limit < Unlimited {
+				return nil, fmt.Errorf("plan %s: invalid limit %d for %s", plan, limit, feature)
+			}
+		}
+	}
+	return &Catalog{doc: doc}, nil
+}
+
+// Lookup returns what the plan grants for the feature. Unknown plans include nothing.
+func (c *Catalog) Lookup(plan, feature string) Entitlement {
+	limit, ok := c.doc.Plans[plan][feature]
+	switch {
+	case !ok || limit == 0:
+		return Entitlement{}
+	case limit == Unlimited:
+		return Entitlement{Included: true, Unlimited: true}
+	default:
+		return Entitlement{Included: true, Limit: limit}
+	}
+}
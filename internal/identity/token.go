@@ -0,0 +1,61 @@
+package identity
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+)
+
+// Claims is the identity assertion the gateway forwards to upstream services.
+// It carries the full verified identity, so services no longer have to trust
+// loose X-User-* headers.
+type Claims struct {
+	UserID         string                 `json:"user_id"`
+	Email          string                 `json:"email,omitempty"`
+	Roles          []string               `json:"roles"`
+	EffectiveRoles []string               `json:"effective_roles,omitempty"` // Roles including those inherited through the role hierarchy
+	Scopes         []string               `json:"scopes,omitempty"`
+	AuthMethod     string                 `json:"auth_method"`
+	APIKeyID       string                 `json:"api_key_id,omitempty"`
+	ActorID        string                 `json:"actor_id,omitempty"` // Admin acting as the user while impersonating
+	Verified       map[string]interface{} `json:"claims,omitempty"`   // Every claim of the verified client token
+	RequestID      string                 `json:"request_id"`
+	ClientIP       string                 `json:"client_ip"`
+	jwt.RegisteredClaims
+}
+
+// Signer mints short-lived internal identity tokens
+type Signer struct {
+	secret   []byte
+	issuer   string
+	audience string
+	ttl      time.Duration
+}
+
+// NewSigner creates a signer from the internal identity configuration
+func NewSigner(cfg *config.Config) *Signer {
+	return &Signer{
+		secret:   []byte(cfg.Identity.Secret),
+		issuer:   cfg.Identity.Issuer,
+		audience: cfg.Identity.Audience,
+		ttl:      cfg.Identity.TTL,
+	}
+}
+
+// Sign fills in the registered claims and returns the HS256-signed token
+func (s *Signer) Sign(claims Claims) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		Issuer:    s.issuer,
+		Subject:   claims.UserID,
+		Audience:  jwt.ClaimStrings{s.audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
@@ -0,0 +1,176 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// globalName identifies the global list in decisions
+const globalName = "global"
+
+// Document is the IP filter file. The global list applies to every request and
+// each group applies to the routes matching its patterns.
+type Document struct {
+	Global List    `json:"global"`
+	Groups []Group `json:"groups"`
+}
+
+// List holds CIDR ranges or single addresses. An address matching Deny is
+// always blocked; a non-empty Allow blocks every address it does not contain.
+type List struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// Group is a list restricted to a set of routes
+type Group struct {
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"` // Route patterns such as "/api/v1/admin/*" or "POST /api/v1/auth/register"
+	List
+}
+
+// Decision is the outcome of checking an address
+type Decision struct {
+	Allowed bool
+	List    string // Name of the list that blocked the address
+	Reason  string
+}
+
+// Filter checks client addresses against a parsed document
+type Filter struct {
+	global compiledList
+	groups []compiledGroup
+}
+
+type compiledList struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+type compiledGroup struct {
+	name  string
+	paths []string
+	list  compiledList
+}
+
+// LoadFile reads and validates an IP filter document from a JSON file
+func LoadFile(file string) (*Filter, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IP filter file: %w", err)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse IP filter file: %w", err)
+	}
+	return New(doc)
+}
+
+// New validates a document and creates a filter for it
+func New(doc Document) (*Filter, error) {
+	global, err := compileList(doc.Global)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", globalName, err)
+	}
+
+	filter := &Filter{global: global}
+	for i, group := range doc.Groups {
+		if group.Name == "" {
+			group.Name = fmt.Sprintf("group-%d", i+1)
+		}
+		if len(group.Paths) == 0 {
+			return nil, fmt.Errorf("group %s: at least one path is required", group.Name)
+		}
+		list, err := compileList(group.List)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", group.Name, err)
+		}
+		filter.groups = append(filter.groups, compiledGroup{name: group.Name, paths: group.Paths, list: list})
+	}
+	return filter, nil
+}
+
+// Check decides whether the address may make the request
+func (f *Filter) Check(ip net.IP, method, requestPath string) Decision {
+	if ip == nil {
+		return Decision{Allowed: false, List: globalName, Reason: "client address could not be determined"}
+	}
+
+	if reason := f.global.check(ip); reason != "" {
+		return Decision{Allowed: false, List: globalName, Reason: reason}
+	}
+	for _, group := range f.groups {
+		if !utils.MatchAnyRoute(group.paths, method, requestPath) {
+			continue
+		}
+		if reason := group.list.check(ip); reason != "" {
+			return Decision{Allowed: false, List: group.name, Reason: reason}
+		}
+	}
+	return Decision{Allowed: true}
+}
+
+// check returns why the address is blocked, or an empty string if it is not
+func (l compiledList) check(ip net.IP) string {
+	if containsIP(l.deny, ip) {
+		return "address is denied"
+	}
+	if len(l.allow) > 0 && !containsIP(l.allow, ip) {
+		return "address is not allowed"
+	}
+	return ""
+}
+
+func compileList(list List) (compiledList, error) {
+	allow, err := parseNetworks(list.Allow)
+	if err != nil {
+		return compiledList{}, err
+	}
+	deny, err := parseNetworks(list.Deny)
+	if err != nil {
+		return compiledList{}, err
+	}
+	return compiledList{allow: allow, deny: deny}, nil
+}
+
+// parseNetworks parses CIDR ranges; single addresses become /32 or /128 networks
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+// Package loadshed limits the number of requests in flight with adaptive
+// (AIMD) limits, globally and per upstream, and sheds low-priority requests
+// first when the gateway is near its limits.
+package loadshed
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+)
+
+// Priority decides how much of a limit a request may use
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // Anonymous requests, shed first
+	PriorityNormal                 // Authenticated requests
+	PriorityHigh                   // Routes configured as high priority, shed last
+)
+
+// String returns the priority name used in logs and error details
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	default:
+		return "high"
+	}
+}
+
+// GlobalScope is the scope reported when the gateway-wide limit sheds a request
+const GlobalScope = "global"
+
+// Limiter is an AIMD concurrency limit. Each request that completes within the
+// latency target without failing grows the limit by one while the limit is in
+// use; a slow or failed request shrinks it by the backoff ratio.
+type Limiter struct {
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+
+	minLimit      float64
+	maxLimit      float64
+	latencyTarget time.Duration
+	backoffRatio  float64
+}
+
+// NewLimiter creates a limiter starting at the initial limit
+func NewLimiter(initial, minLimit, maxLimit int, latencyTarget time.Duration, backoffRatio float64) *Limiter {
+	return &Limiter{
+		limit:         float64(initial),
+		minLimit:      float64(minLimit),
+		maxLimit:      float64(maxLimit),
+		latencyTarget: latencyTarget,
+		backoffRatio:  backoffRatio,
+	}
+}
+
+// tryAcquire admits a request if fewer than share of the limit are in flight
+func (l *Limiter) tryAcquire(share float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inflight) >= math.Max(1, math.Floor(l.limit*share)) {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+// release ends a request and adjusts the limit from its outcome
+func (l *Limiter) release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Only grow while the limit is actually being used, so idle periods do not inflate it
+	inUse := float64(l.inflight)*2 >= l.limit
+	l.inflight--
+
+	switch {
+	case failed || latency > l.latencyTarget:
+		l.limit = math.Max(l.minLimit, l.limit*l.backoffRatio)
+	case inUse:
+		l.limit = math.Min(l.maxLimit, l.limit+1)
+	}
+}
+
+// cancel ends a request without adjusting the limit
+func (l *Limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+}
+
+// Stats returns the current limit and the requests in flight
+func (l *Limiter) Stats() (limit, inflight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit), l.inflight
+}
+
+// Shedder combines the global limit with one limit per upstream
+type Shedder struct {
+	cfg    config.ConcurrencyConfig
+	global *Limiter
+
+	mu        sync.Mutex
+	upstreams map[string]*Limiter
+}
+
+// NewShedder creates the global limiter; upstream limiters are created on first use
+func NewShedder(cfg config.ConcurrencyConfig) *Shedder {
+	return &Shedder{
+		cfg:       cfg,
+		global:    NewLimiter(cfg.GlobalInitialLimit, cfg.MinLimit, cfg.GlobalMaxLimit, cfg.LatencyTarget, cfg.BackoffRatio),
+		upstreams: make(map[string]*Limiter),
+	}
+}
+
+// Slot is an admitted request's place in the global and upstream limits
+type Slot struct {
+	global, upstream *Limiter
+}
+
+// Done ends the request and adjusts the limits from the upstream's latency and outcome
+func (s *Slot) Done(latency time.Duration, failed bool) {
+	s.upstream.release(latency, failed)
+	s.global.release(latency, failed)
+}
+
+// Cancel ends a request that never reached the upstream, such as one the
+// gateway rejected itself, without adjusting the limits
+func (s *Slot) Cancel() {
+	s.upstream.cancel()
+	s.global.cancel()
+}
+
+// Acquire admits a request to the upstream, or returns the scope that shed it.
+// Admitted requests must call Done or Cancel on the returned slot when they finish.
+func (s *Shedder) Acquire(upstream string, priority Priority) (slot *Slot, shedBy string, ok bool) {
+	share := s.share(priority)
+
+	if !s.global.tryAcquire(share) {
+		return nil, GlobalScope, false
+	}
+	upstreamLimiter := s.upstream(upstream)
+	if !upstreamLimiter.tryAcquire(share) {
+		s.global.cancel()
+		return nil, upstream, false
+	}
+	return &Slot{global: s.global, upstream: upstreamLimiter}, "", true
+}
+
+func (s *Shedder) share(priority Priority) float64 {
+	switch priority {
+	case PriorityLow:
+		return s.cfg.AnonymousShare
+	case PriorityNormal:
+		return s.cfg.AuthenticatedShare
+	default:
+		return 1
+	}
+}
+
+func (s *Shedder) upstream(name string) *Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limiter, ok := s.upstreams[name]
+	if !ok {
+		limiter = NewLimiter(s.cfg.UpstreamInitialLimit, s.cfg.MinLimit, s.cfg.UpstreamMaxLimit, s.cfg.LatencyTarget, s.cfg.BackoffRatio)
+		s.upstreams[name] = limiter
+	}
+	return limiter
+}
+
+// Stats returns the limit and the requests in flight for a scope: GlobalScope or an upstream name
+func (s *Shedder) Stats(scope string) (limit, inflight int) {
+	if scope == GlobalScope {
+		return s.global.Stats()
+	}
+	return s.upstream(scope).Stats()
+}
@@ -0,0 +1,64 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+)
+
+func testShedder() *Shedder {
+	return NewShedder(config.ConcurrencyConfig{
+		GlobalInitialLimit:   20,
+		GlobalMaxLimit:       100,
+		UpstreamInitialLimit: 20,
+		UpstreamMaxLimit:     100,
+		MinLimit:             1,
+		LatencyTarget:        time.Second,
+		BackoffRatio:         0.5,
+		AnonymousShare:       1,
+		AuthenticatedShare:   1,
+	})
+}
+
+func TestSlotCancelKeepsLimits(t *testing.T) {
+	shedder := testShedder()
+
+	slot, _, ok := shedder.Acquire("user", PriorityLow)
+	if !ok {
+		t.Fatal("Acquire() shed the first request")
+	}
+	slot.Cancel()
+
+	for _, scope := range []string{GlobalScope, "user"} {
+		limit, inflight := shedder.Stats(scope)
+		if limit != 20 || inflight != 0 {
+			t.Errorf("%s: limit, inflight = %d, %d, want 20, 0", scope, limit, inflight)
+		}
+	}
+}
+
+func TestSlotDoneAdjustsLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency time.Duration
+		failed  bool
+		want    int
+	}{
+		{"slow upstream backs off", 2 * time.Second, false, 10},
+		{"failed upstream backs off", time.Millisecond, true, 10},
+		{"fast upstream leaves an idle limit", time.Millisecond, false, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shedder := testShedder()
+			slot, _, _ := shedder.Acquire("user", PriorityLow)
+			slot.Done(tt.latency, tt.failed)
+
+			if limit, _ := shedder.Stats("user"); limit != tt.want {
+				t.Errorf("limit = %d, want %d", limit, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redis_rate/v9"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/roles"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// errAPIKeyNotFound is returned by a store when no key matches the hash
+var errAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey describes a partner API key. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID            string       `json:"id"`
+	Hash          string       `json:"hash"`           // Hex-encoded SHA-256 of the raw key
+	Owner         string       `json:"owner"`          // Partner the key was issued to
+	Scopes        []string     `json:"scopes"`         // Permissions granted to the key
+	Roles         []string     `json:"roles"`          // Roles used by RoleAuthMiddleware, defaults to partner
+	AllowedRoutes []string     `json:"allowed_routes"` // Route patterns the key may call, empty allows all
+	ExpiresAt     *time.Time   `json:"expires_at,omitempty"`
+	Quota         *APIKeyQuota `json:"quota,omitempty"`
+}
+
+// APIKeyQuota is the request budget of a single API key
+type APIKeyQuota struct {
+	Limit  int             `json:"limit"`  // Requests allowed per window
+	Window config.Duration `json:"window"` // Length of the window
+}
+
+// APIKeyStore looks up API keys by the hash of the raw key
+type APIKeyStore interface {
+	Lookup(ctx context.Context, hash string) (*APIKey, error)
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash under which a key is stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// fileAPIKeyStore serves API keys from a JSON file loaded at startup
+type fileAPIKeyStore struct {
+	keys map[string]*APIKey
+}
+
+// newFileAPIKeyStore reads a JSON array of API keys from the given path
+func newFileAPIKeyStore(path string) (*fileAPIKeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key file: %w", err)
+	}
+
+	var keys []*APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API key file: %w", err)
+	}
+
+	store := &fileAPIKeyStore{keys: make(map[string]*APIKey, len(keys))}
+	for _, key := range keys {
+		store.keys[key.Hash] = key
+	}
+	return store, nil
+}
+
+func (s *fileAPIKeyStore) Lookup(_ context.Context, hash string) (*APIKey, error) {
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, errAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// redisAPIKeyStore serves API keys stored as JSON values under prefix+hash
+type redisAPIKeyStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func (s *redisAPIKeyStore) Lookup(ctx context.Context, hash string) (*APIKey, error) {
+	data, err := s.client.Get(ctx, s.prefix+hash).Bytes()
+	if err == redis.Nil {
+		return nil, errAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var key APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid API key record: %w", err)
+	}
+	key.Hash = hash
+	return &key, nil
+}
+
+// APIKeyAuthMiddleware creates a middleware that authenticates partner requests
+// by API key and stores a UserClaims identity in the context
+func APIKeyAuthMiddleware(cfg *config.Config, logger *zap.Logger, redisClient redis.UniversalClient, hierarchy *roles.Hierarchy) gin.HandlerFunc {
+	// Redis is used for per-key quotas and, optionally, as the key store
+	limiter := redis_rate.NewLimiter(redisClient)
+
+	var store APIKeyStore
+	if cfg.APIKeys.Store == "redis" {
+		store = &redisAPIKeyStore{client: redisClient, prefix: cfg.APIKeys.RedisPrefix}
+	} else {
+		fileStore, err := newFileAPIKeyStore(cfg.APIKeys.File)
+		if err != nil {
+			// Without keys every request is rejected rather than silently allowed
+			logger.Error("Failed to load API keys", zap.Error(err), zap.String("file", cfg.APIKeys.File))
+			fileStore = &fileAPIKeyStore{keys: map[string]*APIKey{}}
+		}
+		store = fileStore
+	}
+
+	logger.Info("API key authentication initialized",
+		zap.String("store", cfg.APIKeys.Store),
+		zap.String("header", cfg.APIKeys.Header),
+	)
+
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader(cfg.APIKeys.Header)
+		if rawKey == "" {
+			logger.Debug("Missing API key header")
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "API key required", nil))
+			c.Abort()
+			return
+		}
+
+		key, err := store.Lookup(c.Request.Context(), HashAPIKey(rawKey))
+		if err == errAPIKeyNotFound {
+			logger.Debug("Unknown API key")
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "Invalid API key", nil))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			logger.Error("API key lookup failed", zap.Error(err))
+			c.Error(apiErrors.ServiceUnavailableError("API key verification unavailable", err))
+			c.Abort()
+			return
+		}
+
+		if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+			logger.Debug("Expired API key", zap.String("key_id", key.ID))
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "API key expired", nil))
+			c.Abort()
+			return
+		}
+
+		if len(key.AllowedRoutes) > 0 && !utils.MatchAnyRoute(key.AllowedRoutes, c.Request.Method, c.Request.URL.Path) {
+			logger.Debug("API key not allowed on route",
+				zap.String("key_id", key.ID),
+				zap.String("path", c.Request.URL.Path))
+			c.Error(apiErrors.New(apiErrors.ErrorTypeForbidden, "API key not allowed for this route", nil))
+			c.Abort()
+			return
+		}
+
+		// Enforce the per-key quota
+		if key.Quota != nil && key.Quota.Limit > 0 && key.Quota.Window > 0 {
+			limit := redis_rate.Limit{
+				Rate:   key.Quota.Limit,
+				Burst:  key.Quota.Limit,
+				Period: key.Quota.Window.Std(),
+			}
+			res, err := limiter.Allow(c.Request.Context(), "rl:apikey:"+key.ID, limit)
+			if err != nil {
+				// Same policy as the global limiter: allow the request but log it
+				logger.Error("API key quota Redis error", zap.Error(err), zap.String("key_id", key.ID))
+			} else {
+				c.Header("X-Quota-Limit", strconv.Itoa(key.Quota.Limit))
+				c.Header("X-Quota-Remaining", strconv.Itoa(res.Remaining))
+				if res.Allowed <= 0 {
+					logger.Warn("API key quota exceeded", zap.String("key_id", key.ID))
+					c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+					c.Error(apiErrors.RateLimitedError("API key quota exceeded"))
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		keyRoles := key.Roles
+		if len(keyRoles) == 0 {
+			keyRoles = []string{constants.RolePartner}
+		}
+
+		claims := &UserClaims{
+			UserID:     key.Owner,
+			Roles:      keyRoles,
+			Scopes:     key.Scopes,
+			AuthMethod: constants.AuthMethodAPIKey,
+			APIKeyID:   key.ID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject: key.ID,
+			},
+		}
+		if key.ExpiresAt != nil {
+			claims.ExpiresAt = jwt.NewNumericDate(*key.ExpiresAt)
+		}
+
+		// The raw key is a credential for the gateway only; never forward it upstream
+		c.Request.Header.Del(cfg.APIKeys.Header)
+
+		setAuthenticatedUser(c, claims, hierarchy)
+		logger.Debug("Authenticated API key",
+			zap.String("key_id", key.ID),
+			zap.String("owner", key.Owner),
+			zap.Strings("scopes", key.Scopes))
+
+		c.Next()
+	}
+}
+
+// AuthMiddleware authenticates a request with any of the given methods.
+// An API key header selects API key authentication; otherwise JWT is used.
+// The introspector and role hierarchy are shared by all route groups.
+func AuthMiddleware(cfg *config.Config, logger *zap.Logger, redisClient redis.UniversalClient, introspector *TokenIntrospector, hierarchy *roles.Hierarchy, methods ...string) gin.HandlerFunc {
+	if len(methods) == 0 {
+		methods = []string{constants.AuthMethodJWT}
+	}
+
+	var jwtAuth, apiKeyAuth gin.HandlerFunc
+	for _, method := range methods {
+		switch method {
+		case constants.AuthMethodJWT:
+			jwtAuth = JWTAuthMiddleware(cfg, logger, introspector, hierarchy)
+		case constants.AuthMethodAPIKey:
+			if cfg.APIKeys.Enabled {
+				apiKeyAuth = APIKeyAuthMiddleware(cfg, logger, redisClient, hierarchy)
+			}
+		}
+	}
+
+	return func(c *gin.Context) {
+		if apiKeyAuth != nil && c.GetHeader(cfg.APIKeys.Header) != "" {
+			apiKeyAuth(c)
+			return
+		}
+		if jwtAuth != nil {
+			jwtAuth(c)
+			return
+		}
+
+		logger.Debug("No supported authentication method", zap.Strings("methods", methods))
+		c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "Authentication required", nil))
+		c.Abort()
+	}
+}
+
+// ScopeAuthMiddleware creates a middleware that requires API key callers to
+// hold all of the given scopes. Users authenticated by token are limited by
+// their roles instead and pass through.
+func ScopeAuthMiddleware(requiredScopes []string, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := userClaimsFromContext(c)
+		if !ok {
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "User claims not found", nil))
+			c.Abort()
+			return
+		}
+		if claims.AuthMethod != constants.AuthMethodAPIKey {
+			c.Next()
+			return
+		}
+
+		granted := make(map[string]bool, len(claims.Scopes))
+		for _, scope := range claims.Scopes {
+			granted[scope] = true
+		}
+
+		var missing []string
+		for _, scope := range requiredScopes {
+			if !granted[scope] {
+				missing = append(missing, scope)
+			}
+		}
+
+		if len(missing) > 0 {
+			logger.Debug("Missing required scopes",
+				zap.String("user_id", claims.UserID),
+				zap.Strings("missing_scopes", missing))
+			c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeForbidden, "Insufficient scope",
+				map[string]interface{}{"missing_scopes": missing}, nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
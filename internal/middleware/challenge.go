@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/challenge"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// ChallengeMiddleware creates a middleware that verifies the bot challenge token
+// (CAPTCHA) sent with the request. On routes listed in the required routes a
+// missing or failed challenge is rejected; elsewhere the token is optional and
+// a passed challenge is only recorded, so login protection can rely on it.
+// The outcome is forwarded to the upstream in the result header.
+func ChallengeMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	// If challenge verification is not enabled, just return a dummy middleware that does nothing
+	if !cfg.Challenge.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	verifier, err := challenge.NewVerifier(cfg.Challenge.Provider, cfg.Challenge.Secret,
+		cfg.Challenge.VerifyURL, &http.Client{Timeout: cfg.Challenge.Timeout})
+	if err != nil {
+		// Without a verifier no challenge can pass, so required routes stay closed
+		logger.Error("Failed to create challenge verifier", zap.Error(err), zap.String("provider", cfg.Challenge.Provider))
+		verifier = &challenge.FakeVerifier{}
+	}
+
+	logger.Info("Challenge verification initialized",
+		zap.String("provider", verifier.Provider()),
+		zap.Strings("requiredRoutes", cfg.Challenge.RequiredRoutes),
+	)
+
+	return func(c *gin.Context) {
+		required := utils.MatchAnyRoute(cfg.Challenge.RequiredRoutes, c.Request.Method, c.Request.URL.Path)
+
+		token := c.GetHeader(cfg.Challenge.Header)
+		c.Request.Header.Del(cfg.Challenge.Header)
+		if token == "" && cfg.Challenge.BodyField != "" {
+			body, err := peekJSONBody(c)
+			if err != nil {
+				c.Error(apiErrors.BadRequestError("Invalid request body", err))
+				c.Abort()
+				return
+			}
+			if value, found := lookupField(body, cfg.Challenge.BodyField); found {
+				token, _ = value.(string)
+			}
+		}
+
+		if token == "" {
+			if required {
+				abortChallenge(c, constants.ErrorCodeChallengeRequired, "Challenge verification required")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		result, err := verifier.Verify(c.Request.Context(), token, c.ClientIP())
+		if err != nil {
+			logger.Error("Challenge verification failed", zap.Error(err), zap.String("provider", verifier.Provider()))
+			if required {
+				c.Error(apiErrors.ServiceUnavailableError("Challenge verification unavailable", err))
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		passed := result.Success && (result.Score == nil || *result.Score >= cfg.Challenge.MinScore)
+		c.Request.Header.Set(cfg.Challenge.ResultHeader, formatChallengeResult(verifier.Provider(), passed, result))
+
+		if !passed {
+			logger.Info("Challenge rejected",
+				zap.String("clientIP", c.ClientIP()),
+				zap.String("path", c.Request.URL.Path),
+				zap.Strings("errorCodes", result.ErrorCodes))
+			if required {
+				abortChallenge(c, constants.ErrorCodeChallengeFailed, "Challenge verification failed")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Set(constants.ContextKeyChallengeVerified, true)
+		c.Next()
+	}
+}
+
+// formatChallengeResult renders the result header, e.g. "passed=true; provider=hcaptcha; score=0.90"
+func formatChallengeResult(provider string, passed bool, result challenge.Result) string {
+	parts := []string{fmt.Sprintf("passed=%t", passed), "provider=" + provider}
+	if result.Score != nil {
+		parts = append(parts, fmt.Sprintf("score=%.2f", *result.Score))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// abortChallenge rejects the request with a machine-readable challenge error code
+func abortChallenge(c *gin.Context, code, message string) {
+	c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeForbidden, message,
+		map[string]interface{}{"code": code}, nil))
+	c.Abort()
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+)
+
+// ConfigureClientIP sets how gin resolves c.ClientIP(). The client IP headers
+// are only read when the connection comes from a trusted proxy; the address
+// is then taken from the right of X-Forwarded-For, skipping trusted proxies,
+// so clients cannot spoof it by sending the header themselves.
+func ConfigureClientIP(router *gin.Engine, cfg *config.Config, logger *zap.Logger) error {
+	if err := router.SetTrustedProxies(cfg.ClientIP.TrustedProxies); err != nil {
+		return err
+	}
+	router.ForwardedByClientIP = true
+	router.RemoteIPHeaders = cfg.ClientIP.Headers
+
+	logger.Info("Client IP resolution configured",
+		zap.Strings("trustedProxies", cfg.ClientIP.TrustedProxies),
+		zap.Strings("headers", cfg.ClientIP.Headers),
+		zap.Int("ipv6PrefixLength", cfg.ClientIP.IPv6PrefixLength),
+	)
+	return nil
+}
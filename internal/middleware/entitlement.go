@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/entitlements"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+)
+
+// EntitlementMiddleware creates a middleware that meters a premium feature by
+// the caller's subscription plan. Every use is counted per user per day in
+// Redis; uses whose upstream request fails are refunded. API key callers have
+// their own quotas and are not metered. It must run after authentication.
+func EntitlementMiddleware(cfg *config.Config, logger *zap.Logger, redisClient redis.UniversalClient, feature string) gin.HandlerFunc {
+	// If entitlements are not enabled, just return a dummy middleware that does nothing
+	if !cfg.Entitlements.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	catalog, err := entitlements.LoadFile(cfg.Entitlements.File)
+	if err != nil {
+		// Without a catalog no plan includes the feature
+		logger.Error("Failed to load entitlements file", zap.Error(err), zap.String("file", cfg.Entitlements.File))
+		catalog, _ = entitlements.NewCatalog(entitlements.Document{})
+	}
+
+	location, err := time.LoadLocation(cfg.Entitlements.Timezone)
+	if err != nil {
+		logger.Error("Invalid entitlements timezone, using UTC", zap.Error(err), zap.String("timezone", cfg.Entitlements.Timezone))
+		location = time.UTC
+	}
+
+	return func(c *gin.Context) {
+		claims, ok := userClaimsFromContext(c)
+		if !ok {
+			logger.Debug("User claims not found in context")
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "User claims not found", nil))
+			c.Abort()
+			return
+		}
+		if claims.AuthMethod == constants.AuthMethodAPIKey {
+			c.Next()
+			return
+		}
+
+		plan := cfg.Entitlements.DefaultPlan
+		if value, found := claims.Claim(cfg.Entitlements.PlanClaim); found {
+			if name, isString := value.(string); isString && name != "" {
+				plan = name
+			}
+		}
+
+		entitlement := catalog.Lookup(plan, feature)
+		if !entitlement.Included {
+			logger.Debug("Feature not included in plan",
+				zap.String("user_id", claims.UserID),
+				zap.String("plan", plan),
+				zap.String("feature", feature))
+			c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeForbidden, "This feature is not included in your plan",
+				map[string]interface{}{
+					"code":    constants.ErrorCodePlanUpgradeRequired,
+					"feature": feature,
+					"plan":    plan,
+				}, nil))
+			c.Abort()
+			return
+		}
+		if entitlement.Unlimited {
+			c.Next()
+			return
+		}
+
+		// Counters reset at midnight in the configured time zone
+		now := time.Now().In(location)
+		resetAt := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+		key := fmt.Sprintf("%s%s:%s:%s", cfg.Entitlements.KeyPrefix, feature, claims.UserID, now.Format("2006-01-02"))
+
+		used, err := redisClient.Incr(c.Request.Context(), key).Result()
+		if err != nil {
+			// Premium features stay usable while Redis is down
+			logger.Error("Entitlement Redis error", zap.Error(err), zap.String("feature", feature))
+			c.Next()
+			return
+		}
+		if used == 1 {
+			redisClient.ExpireAt(c.Request.Context(), key, resetAt.Add(time.Hour))
+		}
+
+		remaining := int64(entitlement.Limit) - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Header("X-Quota-Limit", strconv.Itoa(entitlement.Limit))
+		c.Header("X-Quota-Remaining", strconv.FormatInt(remaining, 10))
+		c.Header("X-Quota-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+
+		if used > int64(entitlement.Limit) {
+			logger.Info("Daily quota exhausted",
+				zap.String("user_id", claims.UserID),
+				zap.String("plan", plan),
+				zap.String("feature", feature))
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(resetAt).Seconds())+1))
+			c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeRateLimited, "Daily limit reached for this feature",
+				map[string]interface{}{
+					"code":     constants.ErrorCodeQuotaExceeded,
+					"feature":  feature,
+					"plan":     plan,
+					"limit":    entitlement.Limit,
+					"reset_at": resetAt.UTC().Format(time.RFC3339),
+				}, nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		// Failed requests do not use up the quota
+		if c.Writer.Status() >= 400 {
+			refundCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := redisClient.Decr(refundCtx, key).Err(); err != nil {
+				logger.Error("Failed to refund quota", zap.Error(err), zap.String("feature", feature))
+			}
+		}
+	}
+}
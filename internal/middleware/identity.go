@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/identity"
+)
+
+// StripIdentityHeadersMiddleware removes identity and challenge result headers
+// sent by clients. Only the gateway may set them, after it has verified the caller.
+func StripIdentityHeadersMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	headers := []string{
+		constants.HeaderUserID,
+		constants.HeaderUserRole,
+		constants.HeaderUsername,
+		constants.HeaderActorID,
+		cfg.Identity.Header,
+		cfg.Challenge.ResultHeader,
+	}
+
+	return func(c *gin.Context) {
+		for _, header := range headers {
+			if c.Request.Header.Get(header) != "" {
+				logger.Debug("Removed client-supplied identity header", zap.String("header", header))
+				c.Request.Header.Del(header)
+			}
+		}
+		c.Next()
+	}
+}
+
+// IdentityPropagationMiddleware adds the authenticated identity to the request
+// before it is proxied: a signed identity token carrying the full claim set
+// and, for existing services, the plain X-User-* headers. It must run after
+// authentication.
+func IdentityPropagationMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	var signer *identity.Signer
+	if cfg.Identity.Enabled {
+		signer = identity.NewSigner(cfg)
+	}
+
+	return func(c *gin.Context) {
+		claims, ok := userClaimsFromContext(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if cfg.Identity.LegacyHeaders || signer == nil {
+			c.Request.Header.Set(constants.HeaderUserID, claims.UserID)
+			if claims.Email != "" {
+				c.Request.Header.Set(constants.HeaderUsername, claims.Email)
+			}
+			// If the user has any roles, the first role is added as a header.
+			if len(claims.Roles) > 0 {
+				c.Request.Header.Set(constants.HeaderUserRole, claims.Roles[0])
+			}
+			if claims.Act != nil {
+				c.Request.Header.Set(constants.HeaderActorID, claims.Act.Sub)
+			}
+		}
+
+		actorID := ""
+		if claims.Act != nil {
+			actorID = claims.Act.Sub
+		}
+
+		if signer != nil {
+			token, err := signer.Sign(identity.Claims{
+				UserID:         claims.UserID,
+				Email:          claims.Email,
+				Roles:          claims.Roles,
+				EffectiveRoles: claims.EffectiveRoles,
+				Scopes:         claims.Scopes,
+				AuthMethod:     claims.AuthMethod,
+				APIKeyID:       claims.APIKeyID,
+				ActorID:        actorID,
+				Verified:       claims.Extra,
+				RequestID:      c.GetHeader(constants.HeaderRequestID),
+				ClientIP:       c.ClientIP(),
+			})
+			if err != nil {
+				logger.Error("Failed to sign identity token", zap.Error(err))
+				c.Error(apiErrors.InternalError(constants.ErrInternalServer, err))
+				c.Abort()
+				return
+			}
+			c.Request.Header.Set(cfg.Identity.Header, token)
+		}
+
+		c.Next()
+	}
+}
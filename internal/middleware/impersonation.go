@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/audit"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// Actor is the party acting on behalf of the token subject (RFC 8693 "act" claim)
+type Actor struct {
+	Sub   string `json:"sub"`
+	Email string `json:"email,omitempty"`
+}
+
+// ImpersonationMiddleware creates a middleware that handles requests made with
+// an impersonation token: dangerous routes are blocked and every request is
+// recorded in the audit log together with the real admin. It must run after
+// authentication.
+func ImpersonationMiddleware(cfg *config.Config, logger *zap.Logger, auditLogger *audit.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := userClaimsFromContext(c)
+		if !ok || claims.Act == nil {
+			c.Next()
+			return
+		}
+
+		event := audit.Event{
+			Action:    constants.AuditImpersonationRequest,
+			ActorID:   claims.Act.Sub,
+			SubjectID: claims.UserID,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			ClientIP:  c.ClientIP(),
+			RequestID: c.GetHeader(constants.HeaderRequestID),
+			Details:   map[string]interface{}{"token_id": claims.ID},
+		}
+
+		if !cfg.Impersonation.Enabled || utils.MatchAnyRoute(cfg.Impersonation.BlockedRoutes, c.Request.Method, c.Request.URL.Path) {
+			logger.Warn("Blocked request while impersonating",
+				zap.String("admin_id", claims.Act.Sub),
+				zap.String("user_id", claims.UserID),
+				zap.String("path", c.Request.URL.Path))
+
+			event.Details["blocked"] = true
+			auditLogger.Record(event)
+
+			c.Error(apiErrors.New(apiErrors.ErrorTypeForbidden, "This action is not allowed while impersonating", nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		event.Status = c.Writer.Status()
+		auditLogger.Record(event)
+	}
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+)
+
+// maxIntrospectionCacheEntries bounds the cache before expired entries are purged
+const maxIntrospectionCacheEntries = 10000
+
+// introspectionResponse is an RFC 7662 introspection response, including the
+// custom user_id, email and roles members returned by auth-service
+type introspectionResponse struct {
+	Active   bool     `json:"active"`
+	Scope    string   `json:"scope"`
+	ClientID string   `json:"client_id"`
+	Username string   `json:"username"`
+	Sub      string   `json:"sub"`
+	Exp      int64    `json:"exp"`
+	UserID   string   `json:"user_id"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles"`
+	ACR      string   `json:"acr"`
+	AMR      []string `json:"amr"`
+	AuthTime int64    `json:"auth_time"`
+}
+
+// introspectionEntry is a cached introspection result; nil claims mark an inactive token
+type introspectionEntry struct {
+	claims    *UserClaims
+	expiresAt time.Time
+}
+
+// TokenIntrospector validates opaque tokens against the introspection endpoint
+// and caches the results. One introspector is shared by all route groups.
+type TokenIntrospector struct {
+	cfg        config.IntrospectionConfig
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[string]introspectionEntry
+}
+
+// NewTokenIntrospector creates the introspector for opaque tokens (for example
+// from the admin SSO). It returns nil when AUTH_TOKEN_MODE is jwt.
+func NewTokenIntrospector(cfg *config.Config, logger *zap.Logger) *TokenIntrospector {
+	if cfg.Introspection.Mode == "jwt" {
+		return nil
+	}
+	logger.Info("Token introspection enabled",
+		zap.String("mode", cfg.Introspection.Mode),
+		zap.String("url", cfg.Introspection.URL))
+	return &TokenIntrospector{
+		cfg:        cfg.Introspection,
+		httpClient: &http.Client{Timeout: cfg.Introspection.Timeout},
+		cache:      make(map[string]introspectionEntry),
+	}
+}
+
+// Introspect returns the claims of an active token, or nil for an inactive one.
+// An error means the endpoint could not be asked and the token state is unknown.
+func (i *TokenIntrospector) Introspect(ctx context.Context, token string) (*UserClaims, error) {
+	sum := sha256.Sum256([]byte(token))
+	cacheKey := hex.EncodeToString(sum[:])
+
+	i.mu.Lock()
+	entry, found := i.cache[cacheKey]
+	i.mu.Unlock()
+	if found && time.Now().Before(entry.expiresAt) {
+		return entry.claims, nil
+	}
+
+	claims, err := i.request(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Active tokens are cached until they expire (capped), inactive ones briefly
+	expiresAt := time.Now().Add(i.cfg.NegativeCacheTTL)
+	if claims != nil {
+		expiresAt = time.Now().Add(i.cfg.MaxCacheTTL)
+		if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(expiresAt) {
+			expiresAt = claims.ExpiresAt.Time
+		}
+	}
+
+	i.mu.Lock()
+	if len(i.cache) >= maxIntrospectionCacheEntries {
+		now := time.Now()
+		for key, cached := range i.cache {
+			if now.After(cached.expiresAt) {
+				delete(i.cache, key)
+			}
+		}
+	}
+	if len(i.cache) < maxIntrospectionCacheEntries {
+		i.cache[cacheKey] = introspectionEntry{claims: claims, expiresAt: expiresAt}
+	}
+	i.mu.Unlock()
+
+	return claims, nil
+}
+
+// request calls the introspection endpoint and maps the response into UserClaims
+func (i *TokenIntrospector) request(ctx context.Context, token string) (*UserClaims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(constants.HeaderContentType, "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", constants.HeaderApplicationJSON)
+	if i.cfg.ClientID != "" {
+		req.SetBasicAuth(i.cfg.ClientID, i.cfg.ClientSecret)
+	}
+
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read introspection response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned %d", resp.StatusCode)
+	}
+
+	var result introspectionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse introspection response: %w", err)
+	}
+	if !result.Active {
+		return nil, nil
+	}
+	if result.Exp > 0 && time.Unix(result.Exp, 0).Before(time.Now()) {
+		return nil, nil
+	}
+
+	var extra map[string]interface{}
+	if err := json.Unmarshal(body, &extra); err != nil {
+		return nil, fmt.Errorf("failed to parse introspection response: %w", err)
+	}
+
+	claims := &UserClaims{
+		UserID:     result.UserID,
+		Email:      result.Email,
+		Roles:      result.Roles,
+		Scopes:     strings.Fields(result.Scope),
+		ACR:        result.ACR,
+		AMR:        result.AMR,
+		AuthMethod: constants.AuthMethodIntrospection,
+		Extra:      extra,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: result.Sub,
+		},
+	}
+	if claims.UserID == "" {
+		claims.UserID = result.Sub
+	}
+	if claims.Email == "" {
+		claims.Email = result.Username
+	}
+	if result.AuthTime > 0 {
+		claims.AuthTime = jwt.NewNumericDate(time.Unix(result.AuthTime, 0))
+	}
+	if result.Exp > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Unix(result.Exp, 0))
+	}
+	return claims, nil
+}
+
+// looksLikeJWT reports whether a token has the three-part JWS compact form
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/ipfilter"
+)
+
+// IPFilterMiddleware creates a middleware that blocks client addresses using the
+// allow and deny lists of the IP filter file. The file is reloaded when it changes.
+// The client address is the connection address unless the connection comes
+// from one of TRUSTED_PROXIES, whose forwarding headers are then read (see
+// ConfigureClientIP). No proxy is trusted by default, so clients cannot spoof
+// an allowed address with X-Forwarded-For.
+func IPFilterMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	// If IP filtering is not enabled, just return a dummy middleware that does nothing
+	if !cfg.IPFilter.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	filter, err := ipfilter.LoadFile(cfg.IPFilter.File)
+	if err != nil {
+		// Lists that cannot be read must not open up the routes they protect
+		logger.Error("Failed to load IP filter file, denying all requests", zap.Error(err), zap.String("file", cfg.IPFilter.File))
+		return func(c *gin.Context) {
+			c.Error(apiErrors.New(apiErrors.ErrorTypeForbidden, "Access denied", err))
+			c.Abort()
+		}
+	}
+
+	var current atomic.Value
+	current.Store(filter)
+	logger.Info("IP filter initialized", zap.String("file", cfg.IPFilter.File))
+
+	if cfg.IPFilter.ReloadInterval > 0 {
+		go watchIPFilterFile(cfg.IPFilter.File, cfg.IPFilter.ReloadInterval, &current, logger)
+	}
+
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		decision := current.Load().(*ipfilter.Filter).Check(net.ParseIP(clientIP), c.Request.Method, c.Request.URL.Path)
+		if !decision.Allowed {
+			logger.Warn("Request blocked by IP filter",
+				zap.String("clientIP", clientIP),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("list", decision.List),
+				zap.String("reason", decision.Reason))
+
+			c.Error(apiErrors.New(apiErrors.ErrorTypeForbidden, "Access denied", nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// watchIPFilterFile polls the file and swaps in the new lists when it changes.
+// An invalid file is logged and the previous lists stay in effect.
+func watchIPFilterFile(file string, interval time.Duration, current *atomic.Value, logger *zap.Logger) {
+	var lastModified time.Time
+	if info, err := os.Stat(file); err == nil {
+		lastModified = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(file)
+		if err != nil {
+			logger.Error("Failed to stat IP filter file", zap.Error(err), zap.String("file", file))
+			continue
+		}
+		if info.ModTime().Equal(lastModified) {
+			continue
+		}
+		lastModified = info.ModTime()
+
+		filter, err := ipfilter.LoadFile(file)
+		if err != nil {
+			logger.Error("Failed to reload IP filter file, keeping previous lists", zap.Error(err), zap.String("file", file))
+			continue
+		}
+		current.Store(filter)
+		logger.Info("IP filter reloaded", zap.String("file", file))
+	}
+}
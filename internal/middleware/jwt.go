@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
 	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/roles"
 )
 
 // UserClaims represents the custom claims for JWT tokens
@@ -19,50 +21,120 @@ type UserClaims struct {
 	UserID string   `json:"user_id"`
 	Email  string   `json:"email"`
 	Roles  []string `json:"roles"`
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Authentication context, used for step-up checks
+	ACR      string           `json:"acr,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+
+	// Set on impersonation tokens; identifies the admin acting as the user
+	Act *Actor `json:"act,omitempty"`
+
 	jwt.RegisteredClaims
+
+	EffectiveRoles []string `json:"-"` // Roles plus every role they inherit in the role hierarchy
+
+	AuthMethod string                 `json:"-"` // How the caller was authenticated (jwt or api_key)
+	APIKeyID   string                 `json:"-"` // ID of the API key, for API key callers
+	Extra      map[string]interface{} `json:"-"` // Every claim of the token, including custom ones
+}
+
+// UnmarshalJSON decodes the known claims and keeps the full claim set in Extra
+// so custom claims such as plan or email_verified remain available
+func (u *UserClaims) UnmarshalJSON(data []byte) error {
+	type plainClaims UserClaims
+	if err := json.Unmarshal(data, (*plainClaims)(u)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &u.Extra)
+}
+
+// Claim returns the value of a claim by its JSON name
+func (u *UserClaims) Claim(name string) (interface{}, bool) {
+	switch name {
+	case "user_id":
+		return u.UserID, u.UserID != ""
+	case "email":
+		return u.Email, u.Email != ""
+	case "roles":
+		return u.Roles, len(u.Roles) > 0
+	case "scopes":
+		return u.Scopes, len(u.Scopes) > 0
+	case "sub":
+		return u.Subject, u.Subject != ""
+	}
+	value, ok := u.Extra[name]
+	return value, ok
 }
 
-// JWTAuthMiddleware creates a middleware for JWT authentication
-func JWTAuthMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+// JWTAuthMiddleware creates a middleware for JWT authentication. Opaque tokens
+// are checked with introspector, which is nil when AUTH_TOKEN_MODE is jwt.
+func JWTAuthMiddleware(cfg *config.Config, logger *zap.Logger, introspector *TokenIntrospector, hierarchy *roles.Hierarchy) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// First check if we have user info from gateway in headers
-		userID := c.GetHeader(constants.HeaderUserID)
-		userRole := c.GetHeader(constants.HeaderUserRole)
-
-		// If headers are present and we trust the API gateway, we can use these values
-		if userID != "" && userRole != "" {
-			// Store the user info in the context
-			logger.Debug("User authenticated via gateway headers",
-				zap.String("user_id", userID),
-				zap.String("role", userRole))
-
-			// Create simplified claims object from headers
-			c.Set("user", &UserClaims{
-				UserID: userID,
-				Roles:  []string{userRole},
-			})
-			c.Next()
-			return
-		}
-		// Otherwise, fall back to direct JWT validation
+		tokenString, fromCookie := "", false
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			logger.Debug("Missing authorization header or gateway headers")
+		if authHeader == "" && cfg.Session.CookieMode {
+			// Web frontend sessions carry the access token in an HttpOnly cookie
+			if cookie, err := c.Cookie(cfg.Session.AccessCookieName); err == nil && cookie != "" {
+				tokenString, fromCookie = cookie, true
+			}
+		}
+
+		if authHeader == "" && !fromCookie {
+			logger.Debug("Missing authorization header")
 			c.JSON(401, gin.H{"error": "Authentication required"})
 			c.Abort()
 			return
 		}
 
-		// Check if the header has the Bearer prefix
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			logger.Debug("Invalid authorization header format")
-			c.JSON(401, gin.H{"error": "Invalid authentication format"})
-			c.Abort()
-			return
+		if !fromCookie {
+			// Check if the header has the Bearer prefix
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				logger.Debug("Invalid authorization header format")
+				c.JSON(401, gin.H{"error": "Invalid authentication format"})
+				c.Abort()
+				return
+			}
+
+			tokenString = parts[1]
 		}
 
-		tokenString := parts[1]
+		// Cookies are sent automatically by the browser, so state-changing
+		// requests must prove they came from our frontend
+		if fromCookie {
+			if apiErr := verifyCSRF(c, cfg, tokenString); apiErr != nil {
+				logger.Debug("CSRF check failed", zap.String("reason", apiErr.Message))
+				c.Error(apiErr)
+				c.Abort()
+				return
+			}
+		}
+
+		if introspector != nil && (cfg.Introspection.Mode == "introspection" || !looksLikeJWT(tokenString)) {
+			claims, err := introspector.Introspect(c.Request.Context(), tokenString)
+			if err != nil {
+				// An unreachable endpoint must not log users out, so this is not a 401
+				logger.Error("Token introspection failed", zap.Error(err))
+				c.Error(apiErrors.ServiceUnavailableError("Token verification unavailable", err))
+				c.Abort()
+				return
+			}
+			if claims == nil {
+				logger.Debug("Inactive token")
+				c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "Invalid token", nil))
+				c.Abort()
+				return
+			}
+
+			setAuthenticatedUser(c, claims, hierarchy)
+			logger.Debug("Authenticated user via introspection",
+				zap.String("user_id", claims.UserID),
+				zap.Strings("roles", claims.Roles))
+			c.Next()
+			return
+		}
 
 		// Parse the token with improved validation
 		token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -88,6 +160,15 @@ func JWTAuthMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
+			// Identity tokens are for internal services only; never accept one as a client token
+			if isIdentityToken(cfg, claims) {
+				logger.Warn("Rejected internal identity token presented as client token",
+					zap.String("client_ip", c.ClientIP()))
+				c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "Invalid token", nil))
+				c.Abort()
+				return
+			}
+
 			// Check if the token is expired - using the new JWT v5 approach
 			expirationTime, err := claims.GetExpirationTime()
 			if err != nil || expirationTime == nil || expirationTime.Before(time.Now()) {
@@ -98,7 +179,8 @@ func JWTAuthMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
 			}
 
 			// Store the claims in the context for later use
-			c.Set("user", claims)
+			claims.AuthMethod = constants.AuthMethodJWT
+			setAuthenticatedUser(c, claims, hierarchy)
 			logger.Debug("Authenticated user",
 				zap.String("user_id", claims.UserID),
 				zap.String("email", claims.Email),
@@ -114,6 +196,19 @@ func JWTAuthMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
 	}
 }
 
+// isIdentityToken reports whether claims carry the gateway's internal identity issuer or audience
+func isIdentityToken(cfg *config.Config, claims *UserClaims) bool {
+	if cfg.Identity.Issuer != "" && claims.Issuer == cfg.Identity.Issuer {
+		return true
+	}
+	for _, aud := range claims.Audience {
+		if cfg.Identity.Audience != "" && aud == cfg.Identity.Audience {
+			return true
+		}
+	}
+	return false
+}
+
 // RoleAuthMiddleware creates a middleware to check user roles
 func RoleAuthMiddleware(requiredRoles []string, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -141,20 +236,7 @@ func RoleAuthMiddleware(requiredRoles []string, logger *zap.Logger) gin.HandlerF
 		}
 
 		// Check if the user has any of the required roles
-		hasRole := false
-		for _, requiredRole := range requiredRoles {
-			for _, userRole := range claims.Roles {
-				if requiredRole == userRole {
-					hasRole = true
-					break
-				}
-			}
-			if hasRole {
-				break
-			}
-		}
-
-		if !hasRole {
+		if !hasAnyRole(claims, requiredRoles) {
 			logger.Debug("User does not have required role",
 				zap.String("user_id", claims.UserID),
 				zap.Strings("required_roles", requiredRoles))
@@ -166,3 +248,53 @@ func RoleAuthMiddleware(requiredRoles []string, logger *zap.Logger) gin.HandlerF
 		c.Next()
 	}
 }
+
+// hasAnyRole reports whether the user has at least one of the given roles,
+// directly or through the role hierarchy
+func hasAnyRole(claims *UserClaims, required []string) bool {
+	for _, role := range required {
+		for _, userRole := range claims.effectiveRoles() {
+			if role == userRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// effectiveRoles returns the resolved roles, or the assigned roles if they were never resolved
+func (u *UserClaims) effectiveRoles() []string {
+	if u.EffectiveRoles != nil {
+		return u.EffectiveRoles
+	}
+	return u.Roles
+}
+
+// NewRoleHierarchy parses the configured role hierarchy. An invalid hierarchy is
+// logged and ignored, so no role gains permissions it was not assigned.
+func NewRoleHierarchy(cfg *config.Config, logger *zap.Logger) *roles.Hierarchy {
+	hierarchy, err := roles.Parse(cfg.Roles.Hierarchy)
+	if err != nil {
+		logger.Error("Invalid role hierarchy, role inheritance disabled", zap.Error(err))
+		return nil
+	}
+	return hierarchy
+}
+
+// setAuthenticatedUser resolves the effective roles and stores the claims in the context.
+// The claims are copied because introspection results are shared through the cache.
+func setAuthenticatedUser(c *gin.Context, claims *UserClaims, hierarchy *roles.Hierarchy) {
+	resolved := *claims
+	resolved.EffectiveRoles = hierarchy.Effective(claims.Roles)
+	c.Set(constants.ContextKeyUser, &resolved)
+}
+
+// userClaimsFromContext returns the claims stored by the authentication middleware
+func userClaimsFromContext(c *gin.Context) (*UserClaims, bool) {
+	userValue, exists := c.Get(constants.ContextKeyUser)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := userValue.(*UserClaims)
+	return claims, ok
+}
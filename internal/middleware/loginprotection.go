@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/ratelimit"
+)
+
+// reserveLoginScript counts an attempt against the failure counter KEYS[1]
+// before it is forwarded, unless the counter is already past the threshold
+// ARGV[2] (0 means none). Returns whether it was reserved, the count and the
+// milliseconds left in the window ARGV[1].
+var reserveLoginScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+local threshold = tonumber(ARGV[2])
+local reserved = 1
+if threshold > 0 and count > threshold then
+	count = redis.call("DECR", KEYS[1])
+	reserved = 0
+end
+return {reserved, count, redis.call("PTTL", KEYS[1])}
+`)
+
+// refundLoginScript takes back an attempt reserved on the failure counter
+// KEYS[1], unless the counter has expired since
+var refundLoginScript = redis.NewScript(`
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+if count > 0 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+// loginCounter is a failure counter holding a reserved attempt
+type loginCounter struct {
+	key       string // account or IP key, without the prefix
+	threshold int    // lockout threshold, 0 for none
+	count     int64  // failures and attempts in flight, including this one
+}
+
+// LoginProtectionMiddleware creates a middleware that guards the login route
+// against brute-force and credential-stuffing attacks. It counts failed logins
+// (as reported by auth-service's status code) per account and per IP in Redis,
+// delays repeated attempts, locks out after too many failures and can demand a
+// verified challenge once an account or address looks suspicious. Each attempt
+// is counted atomically before it is forwarded and refunded unless it fails, so
+// concurrent attempts cannot get past the lockout threshold.
+func LoginProtectionMiddleware(cfg *config.Config, logger *zap.Logger, redisClient redis.UniversalClient) gin.HandlerFunc {
+	// If login protection is not enabled, just return a dummy middleware that does nothing
+	if !cfg.LoginProtection.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	protection := cfg.LoginProtection
+
+	logger.Info("Login protection initialized",
+		zap.Int("accountLockoutThreshold", protection.AccountLockoutThreshold),
+		zap.Int("ipLockoutThreshold", protection.IPLockoutThreshold),
+		zap.Duration("window", protection.Window),
+	)
+
+	failureStatuses := make(map[int]bool, len(protection.FailureStatuses))
+	for _, status := range protection.FailureStatuses {
+		failureStatuses[status] = true
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		clientIP := c.ClientIP()
+
+		body, err := peekJSONBody(c)
+		if err != nil {
+			c.Error(apiErrors.BadRequestError("Invalid request body", err))
+			c.Abort()
+			return
+		}
+
+		// Accounts are tracked by a hash so identifiers never end up in Redis
+		accountKey := ""
+		if identifier := loginIdentifier(body, protection.IdentifierFields); identifier != "" {
+			sum := sha256.Sum256([]byte(identifier))
+			accountKey = "acct:" + hex.EncodeToString(sum[:])
+		}
+		// IPv6 clients are counted by prefix, as one host can use every address in it
+		ipKey := "ip:" + ratelimit.GroupIP(clientIP, cfg.ClientIP.IPv6PrefixLength)
+
+		// Refuse locked accounts and addresses without asking auth-service
+		retryAfter, err := loginLockout(ctx, redisClient, protection.KeyPrefix, accountKey, ipKey)
+		if err != nil {
+			// Redis problems must not take login down; fall back to the global rate limit
+			logger.Error("Login protection Redis error", zap.Error(err), zap.String("clientIP", clientIP))
+			c.Next()
+			return
+		}
+		if retryAfter > 0 {
+			logger.Warn("Login attempt while locked out",
+				zap.String("clientIP", clientIP),
+				zap.Bool("accountLocked", accountKey != ""),
+				zap.Duration("retryAfter", retryAfter))
+			abortLoginLocked(c, retryAfter)
+			return
+		}
+
+		// Count the attempt as a failure up front; it is refunded unless it fails
+		counters, retryAfter, err := reserveLoginAttempt(ctx, redisClient, protection, accountKey, ipKey)
+		if err != nil {
+			logger.Error("Login protection Redis error", zap.Error(err), zap.String("clientIP", clientIP))
+			c.Next()
+			return
+		}
+		if retryAfter > 0 {
+			logger.Warn("Login attempt over the lockout threshold",
+				zap.String("clientIP", clientIP),
+				zap.Duration("retryAfter", retryAfter))
+			abortLoginLocked(c, retryAfter)
+			return
+		}
+
+		// Earlier failures and attempts still in flight
+		var failures int64
+		for _, counter := range counters {
+			if counter.count-1 > failures {
+				failures = counter.count - 1
+			}
+		}
+
+		// Suspicious accounts and addresses must prove they are human first
+		if protection.ChallengeAfter > 0 && failures >= int64(protection.ChallengeAfter) && !c.GetBool(constants.ContextKeyChallengeVerified) {
+			refundLoginAttempt(redisClient, protection, counters, logger)
+			logger.Info("Login challenge required", zap.String("clientIP", clientIP), zap.Int64("failures", failures))
+			abortChallenge(c, constants.ErrorCodeChallengeRequired, "Challenge verification required")
+			return
+		}
+
+		// Slow down repeated attempts: DelayBase doubles with every further failure
+		if delay := loginDelay(protection, failures); delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				refundLoginAttempt(redisClient, protection, counters, logger)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		switch {
+		case failureStatuses[status]:
+			// The failure is already counted; lock out once it reaches the threshold
+			if err := lockLoginCounters(redisClient, protection, counters); err != nil {
+				logger.Error("Failed to lock out login", zap.Error(err), zap.String("clientIP", clientIP))
+			}
+		case status >= 200 && status < 300 && accountKey != "":
+			// A successful login clears the account's history but not the address's
+			refundLoginAttempt(redisClient, protection, counters, logger)
+			if err := redisClient.Del(ctx, protection.KeyPrefix+"fail:"+accountKey).Err(); err != nil {
+				logger.Error("Failed to reset login failures", zap.Error(err))
+			}
+		default:
+			refundLoginAttempt(redisClient, protection, counters, logger)
+		}
+	}
+}
+
+// loginLockout returns how long the account or address is still locked out
+func loginLockout(ctx context.Context, client redis.UniversalClient, prefix, accountKey, ipKey string) (time.Duration, error) {
+	var longest time.Duration
+	for _, key := range []string{accountKey, ipKey} {
+		if key == "" {
+			continue
+		}
+		ttl, err := client.PTTL(ctx, prefix+"lock:"+key).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest, nil
+}
+
+// reserveLoginAttempt counts the attempt on the account and address failure
+// counters. Each counter is reserved by one script, so Redis Cluster can keep
+// them on different nodes. When a counter is past its threshold the attempts
+// already reserved are refunded and the time until that counter expires is returned.
+func reserveLoginAttempt(ctx context.Context, client redis.UniversalClient, protection config.LoginProtectionConfig, accountKey, ipKey string) ([]loginCounter, time.Duration, error) {
+	candidates := []loginCounter{
+		{key: accountKey, threshold: protection.AccountLockoutThreshold},
+		{key: ipKey, threshold: protection.IPLockoutThreshold},
+	}
+
+	var counters []loginCounter
+	for _, counter := range candidates {
+		if counter.key == "" {
+			continue
+		}
+		values, err := reserveLoginScript.Run(ctx, client,
+			[]string{protection.KeyPrefix + "fail:" + counter.key},
+			protection.Window.Milliseconds(), counter.threshold).Int64Slice()
+		if err == nil && len(values) != 3 {
+			err = fmt.Errorf("unexpected login reservation reply %v", values)
+		}
+		if err != nil {
+			refundLoginAttempt(client, protection, counters, nil)
+			return nil, 0, err
+		}
+
+		counter.count = values[1]
+		if values[0] == 0 {
+			refundLoginAttempt(client, protection, counters, nil)
+			retryAfter := time.Duration(values[2]) * time.Millisecond
+			if retryAfter < time.Second {
+				retryAfter = time.Second
+			}
+			return nil, retryAfter, nil
+		}
+		counters = append(counters, counter)
+	}
+	return counters, 0, nil
+}
+
+// refundLoginAttempt takes back an attempt that did not fail. It runs even if
+// the client has gone away; errors are logged when a logger is given.
+func refundLoginAttempt(client redis.UniversalClient, protection config.LoginProtectionConfig, counters []loginCounter, logger *zap.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, counter := range counters {
+		err := refundLoginScript.Run(ctx, client, []string{protection.KeyPrefix + "fail:" + counter.key}).Err()
+		if err != nil && logger != nil {
+			logger.Error("Failed to refund login attempt", zap.Error(err))
+		}
+	}
+}
+
+// lockLoginCounters locks out the account or address whose failures reached
+// its threshold. It runs even if the client has gone away.
+func lockLoginCounters(client redis.UniversalClient, protection config.LoginProtectionConfig, counters []loginCounter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, counter := range counters {
+		if counter.threshold > 0 && counter.count >= int64(counter.threshold) {
+			if err := client.Set(ctx, protection.KeyPrefix+"lock:"+counter.key, counter.count, protection.LockoutDuration).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loginDelay returns the progressive delay for the number of recent failures
+func loginDelay(protection config.LoginProtectionConfig, failures int64) time.Duration {
+	if protection.DelayAfter <= 0 || failures < int64(protection.DelayAfter) {
+		return 0
+	}
+	delay := protection.DelayBase
+	for i := int64(protection.DelayAfter); i < failures && delay < protection.DelayMax; i++ {
+		delay *= 2
+	}
+	if delay > protection.DelayMax {
+		delay = protection.DelayMax
+	}
+	return delay
+}
+
+// abortLoginLocked rejects a locked-out login attempt with Retry-After
+func abortLoginLocked(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(retryAfter.Round(time.Second).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeRateLimited, "Too many failed login attempts",
+		map[string]interface{}{
+			"code":        constants.ErrorCodeLoginLocked,
+			"retry_after": seconds,
+		}, nil))
+	c.Abort()
+}
+
+// loginIdentifier returns the normalized account identifier from the login body
+func loginIdentifier(body map[string]interface{}, fields []string) string {
+	for _, field := range fields {
+		if value, found := lookupField(body, field); found {
+			if identifier := strings.ToLower(strings.TrimSpace(fmt.Sprint(value))); identifier != "" {
+				return identifier
+			}
+		}
+	}
+	return ""
+}
+
+// peekJSONBody parses a JSON request body and puts it back for the proxy handler.
+// The body is parsed whatever its Content-Type, since upstream decoders may
+// ignore the header; bodies that are not a JSON object are an error, and an
+// empty body yields an empty object.
+func peekJSONBody(c *gin.Context) (map[string]interface{}, error) {
+	body := map[string]interface{}{}
+	if c.Request.Body == nil {
+		return body, nil
+	}
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+	if len(bytes.TrimSpace(bodyBytes)) == 0 {
+		return body, nil
+	}
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return nil, fmt.Errorf("request body must be a JSON object: %w", err)
+	}
+	return body, nil
+}
@@ -7,24 +7,38 @@ import (
 )
 
 // RegisterMiddlewares registers all middleware components with the router
-func RegisterMiddlewares(router *gin.Engine, cfg *config.Config, logger *zap.Logger) {
+func RegisterMiddlewares(router *gin.Engine, cfg *config.Config, logger *zap.Logger) error {
+	// Resolve client addresses before anything reads them; gin trusts every proxy by default
+	if err := ConfigureClientIP(router, cfg, logger); err != nil {
+		return err
+	}
+
 	// Add recovery middleware first to handle panics
 	router.Use(gin.Recovery())
 
 	// Add logger middleware
 	router.Use(LoggerMiddleware(logger))
 
+	// Add error handler middleware before any middleware that can abort with an error.
+	// It renders errors after the rest of the chain returns, so middlewares that abort
+	// early (IP filter, CORS) still get a proper error response.
+	router.Use(ErrorHandlerMiddleware(logger))
+
+	// Drop identity headers sent by clients before anything can trust them
+	router.Use(StripIdentityHeadersMiddleware(cfg, logger))
+
 	// Add CORS middleware early in the chain
 	if cfg.CORS.Enabled {
 		router.Use(CORSMiddleware(cfg, logger))
 	}
 
-	// Add rate limiter middleware
-	if cfg.RateLimiting.Enabled {
-		router.Use(RateLimiterMiddleware(cfg, logger))
+	// Block denied addresses before any route does work for them
+	if cfg.IPFilter.Enabled {
+		router.Use(IPFilterMiddleware(cfg, logger))
 	}
 
-	// Add error handler middleware as the last middleware
-	// This ensures all errors from previous middlewares and handlers are caught
-	router.Use(ErrorHandlerMiddleware(logger))
+	// Rate limiting is applied per route: a per-IP limit before authentication on
+	// protected groups and the health endpoints, and the route policies after
+	// authentication, keyed by user or API key (see routes.newProtectedGroup)
+	return nil
 }
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/outbound"
+)
+
+// OutboundLimitMiddleware holds requests to an upstream to its configured rate
+// and concurrency caps. It only attaches the upstream's gate to the request:
+// the handler that calls the upstream acquires it with AcquireUpstream, so
+// time spent in other middlewares, such as login delays, does not take
+// upstream capacity and requests they reject never queue.
+func OutboundLimitMiddleware(cfg *config.Config, logger *zap.Logger, limiter *outbound.Limiter, upstream string) gin.HandlerFunc {
+	gate := limiter.Gate(upstream)
+	if gate == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	limit := &outboundLimit{
+		gate:       gate,
+		upstream:   upstream,
+		retryAfter: strconv.Itoa(max(ceilSeconds(cfg.Outbound.Upstreams[upstream].QueueTimeout), 1)),
+		logger:     logger,
+	}
+	return func(c *gin.Context) {
+		c.Set(constants.ContextKeyOutboundGate, limit)
+		c.Next()
+	}
+}
+
+// outboundLimit is the gate of a route's upstream, attached to the request
+type outboundLimit struct {
+	gate       *outbound.Gate
+	upstream   string
+	retryAfter string
+	logger     *zap.Logger
+}
+
+// AcquireUpstream waits for the route's upstream to have capacity for the
+// request. Requests over the caps wait in the upstream's queue; when the queue
+// is full or the wait times out the request is aborted with 503 and ok is
+// false. Otherwise the caller must call release once the upstream has answered.
+func AcquireUpstream(c *gin.Context) (release func(), ok bool) {
+	value, _ := c.Get(constants.ContextKeyOutboundGate)
+	limit, limited := value.(*outboundLimit)
+	if !limited {
+		return func() {}, true
+	}
+
+	release, err := limit.gate.Acquire(c.Request.Context())
+	if err == nil {
+		return release, true
+	}
+
+	if !errors.Is(err, outbound.ErrQueueFull) && !errors.Is(err, outbound.ErrQueueTimeout) {
+		// The client went away while queued; there is nobody to answer
+		limit.logger.Debug("Request cancelled while queued for upstream", zap.String("upstream", limit.upstream), zap.Error(err))
+		c.Abort()
+		return nil, false
+	}
+
+	stats := limit.gate.Stats()
+	limit.logger.Warn("Request rejected by outbound limit",
+		zap.String("upstream", limit.upstream),
+		zap.String("reason", err.Error()),
+		zap.Int("inflight", stats.Inflight),
+		zap.Int("queueDepth", stats.QueueDepth),
+		zap.String("path", c.Request.URL.Path))
+
+	c.Header("Retry-After", limit.retryAfter)
+	c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeServiceUnavailable, "Service is at capacity, please retry later",
+		map[string]interface{}{
+			"code":     constants.ErrorCodeUpstreamBusy,
+			"upstream": limit.upstream,
+			"reason":   err.Error(),
+		}, nil))
+	c.Abort()
+	return nil, false
+}
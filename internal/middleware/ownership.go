@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+)
+
+// OwnershipRule declares where a route carries the ID of the resource owner.
+// Either the path parameter or the JSON body field (or both) must equal the
+// authenticated user's ID.
+type OwnershipRule struct {
+	Param         string   // Path parameter holding the owner ID, e.g. "id" for /users/:id/photos
+	BodyField     string   // JSON body field holding the owner ID; dots select nested fields
+	OverrideRoles []string // Roles allowed to act on any user's resources; defaults to OWNERSHIP_OVERRIDE_ROLES
+}
+
+// OwnershipMiddleware creates a middleware that rejects requests for resources
+// owned by another user. It must run after authentication.
+func OwnershipMiddleware(cfg *config.Config, logger *zap.Logger, rule OwnershipRule) gin.HandlerFunc {
+	overrideRoles := rule.OverrideRoles
+	if overrideRoles == nil {
+		overrideRoles = cfg.Ownership.OverrideRoles
+	}
+
+	return func(c *gin.Context) {
+		claims, ok := userClaimsFromContext(c)
+		if !ok {
+			logger.Debug("User claims not found in context")
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "User claims not found", nil))
+			c.Abort()
+			return
+		}
+
+		// Moderators and admins may act on behalf of any user
+		if hasAnyRole(claims, overrideRoles) {
+			c.Next()
+			return
+		}
+
+		if rule.Param != "" {
+			if owner := c.Param(rule.Param); owner != claims.UserID {
+				denyOwnership(c, logger, claims, "path parameter "+rule.Param, owner)
+				return
+			}
+		}
+
+		// The body is inspected whatever its Content-Type, since upstream decoders may ignore the header
+		if rule.BodyField != "" && c.Request.Body != nil {
+			owner, found, err := bodyOwner(c, rule.BodyField)
+			if err != nil {
+				c.Error(apiErrors.BadRequestError("Invalid request body", err))
+				c.Abort()
+				return
+			}
+			// A missing field is fine; a different owner is not
+			if found && owner != claims.UserID {
+				denyOwnership(c, logger, claims, "body field "+rule.BodyField, owner)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// denyOwnership aborts the request with a Forbidden error
+func denyOwnership(c *gin.Context, logger *zap.Logger, claims *UserClaims, source, owner string) {
+	logger.Warn("Ownership check failed",
+		zap.String("user_id", claims.UserID),
+		zap.String("owner_id", owner),
+		zap.String("source", source),
+		zap.String("path", c.Request.URL.Path))
+	c.Error(apiErrors.New(apiErrors.ErrorTypeForbidden, "You do not have access to this resource", nil))
+	c.Abort()
+}
+
+// bodyOwner reads the owner field of the request body and puts the body back
+// for the proxy handler. Form bodies, such as multipart photo uploads, are
+// checked by field name; any other body must be a JSON object.
+func bodyOwner(c *gin.Context, field string) (string, bool, error) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid request body")
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	if len(bytes.TrimSpace(bodyBytes)) == 0 {
+		return "", false, nil
+	}
+
+	switch c.ContentType() {
+	case gin.MIMEMultipartPOSTForm, gin.MIMEPOSTForm:
+		values, err := formValues(c, bodyBytes, field)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid form body")
+		}
+		if len(values) == 0 {
+			return "", false, nil
+		}
+		// Every value must match, so a repeated field cannot smuggle another owner
+		for _, value := range values[1:] {
+			if value != values[0] {
+				return "", false, fmt.Errorf("conflicting values for form field %s", field)
+			}
+		}
+		return values[0], true, nil
+	default:
+		var body map[string]interface{}
+		if err := json.Unmarshal(bodyBytes, &body); err != nil {
+			return "", false, fmt.Errorf("request body must be a JSON object")
+		}
+		value, found := lookupField(body, field)
+		if !found {
+			return "", false, nil
+		}
+		return fmt.Sprint(value), true, nil
+	}
+}
+
+// formValues returns the values of a field in a URL-encoded or multipart form
+// body. Uploaded files are skipped without being buffered again.
+func formValues(c *gin.Context, bodyBytes []byte, field string) ([]string, error) {
+	if c.ContentType() == gin.MIMEPOSTForm {
+		form, err := url.ParseQuery(string(bodyBytes))
+		return form[field], err
+	}
+
+	_, params, err := mime.ParseMediaType(c.GetHeader(constants.HeaderContentType))
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(bytes.NewReader(bodyBytes), params["boundary"])
+	var values []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field && part.FileName() == "" {
+			value, err := io.ReadAll(part)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, string(value))
+		}
+	}
+}
+
+// lookupField returns a possibly nested field ("profile.user_id") of a JSON object
+func lookupField(body map[string]interface{}, field string) (interface{}, bool) {
+	var current interface{} = body
+	for _, part := range strings.Split(field, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
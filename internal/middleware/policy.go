@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/policy"
+)
+
+// PolicyMiddleware creates a middleware that authorizes authenticated requests
+// against the policy file. It must run after authentication.
+func PolicyMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	// If policies are not enabled, just return a dummy middleware that does nothing
+	if !cfg.Policy.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	engine, err := policy.LoadFile(cfg.Policy.File)
+	if err != nil {
+		// A broken policy must not open up the routes it protects
+		logger.Error("Failed to load policy file, denying all requests", zap.Error(err), zap.String("file", cfg.Policy.File))
+		return func(c *gin.Context) {
+			c.Error(apiErrors.New(apiErrors.ErrorTypeForbidden, "Access denied by policy", err))
+			c.Abort()
+		}
+	}
+
+	dryRun := cfg.Policy.DryRun || engine.DryRun()
+	logger.Info("Policy engine initialized", zap.String("file", cfg.Policy.File), zap.Bool("dryRun", dryRun))
+
+	return func(c *gin.Context) {
+		claims, ok := userClaimsFromContext(c)
+		if !ok {
+			logger.Debug("User claims not found in context")
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "User claims not found", nil))
+			c.Abort()
+			return
+		}
+
+		decision := engine.Evaluate(policy.Input{
+			Method:  c.Request.Method,
+			Path:    c.Request.URL.Path,
+			Roles:   claims.effectiveRoles(),
+			Scopes:  claims.Scopes,
+			Claim:   claims.Claim,
+			Headers: c.Request.Header,
+			Query:   c.Request.URL.Query(),
+			Time:    time.Now(),
+		})
+
+		if dryRun {
+			logger.Info("Policy decision (dry run)",
+				zap.String("user_id", claims.UserID),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.Bool("allowed", decision.Allowed),
+				zap.String("rule", decision.Rule),
+				zap.Strings("reasons", decision.Reasons))
+			c.Next()
+			return
+		}
+
+		if !decision.Allowed {
+			logger.Debug("Request denied by policy",
+				zap.String("user_id", claims.UserID),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("rule", decision.Rule),
+				zap.Strings("reasons", decision.Reasons))
+			c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeForbidden, "Access denied by policy", decision, nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,103 +1,216 @@
 package middleware
 
 import (
-	"context"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
-	"github.com/go-redis/redis_rate/v9"
 	"go.uber.org/zap"
 
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
-	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/ratelimit"
 )
 
-// RateLimiterMiddleware creates a Gin middleware for rate limiting requests using Redis
-func RateLimiterMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+// RateLimiterMiddleware creates a Gin middleware that limits requests by the
+// rate limit policy matching the route. Counters are keyed by client IP, user
+// or API key as the policy says, so it must run after authentication on
+// protected routes; on public routes every caller is anonymous.
+func RateLimiterMiddleware(cfg *config.Config, logger *zap.Logger, limiter *ratelimit.Limiter) gin.HandlerFunc {
 	// Check if rate limiting is enabled in the config file
 	// If it's not enabled, just return a dummy middleware that does nothing
-	if !cfg.RateLimiting.Enabled {
+	if !limiter.Enabled() {
 		return func(c *gin.Context) {
 			c.Next()
 		}
 	}
 
-	// If rate limiting is enabled, we first create a Redis client to connect to Redis
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: cfg.RateLimiting.RedisAddress, // Redis server address
-	})
+	// Return the actual middleware function
+	return func(c *gin.Context) {
+		policy := limiter.Match(c.Request.Method, c.Request.URL.Path)
+		claims, authenticated := userClaimsFromContext(c)
+		identity := rateLimitIdentity(c, policy, claims, cfg.ClientIP.IPv6PrefixLength)
+		rate := policy.RateFor(authenticated)
+		cost := limiter.Cost(c.Request) // Expensive routes consume more of the budget
 
-	// Use a context for Redis operations (required by Redis client)
-	ctx := context.Background()
+		enforceRateLimit(c, cfg, logger, limiter, policy, identity, rate, cost)
+	}
+}
 
-	// Try pinging Redis to check if the connection is successful
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		// Log the failure and disable rate limiting
-		logger.Error("Redis connection failed, rate limiting disabled",
-			zap.Error(err),
-			zap.String("redisAddress", cfg.RateLimiting.RedisAddress),
-		)
-		// Return a dummy middleware since Redis is not available
+// PreAuthRateLimiterMiddleware creates a Gin middleware that limits requests
+// per client IP before authentication, so failed token checks, API key
+// guessing and introspection calls are throttled too. It also guards routes
+// without a route group, such as the health endpoints. Every request costs
+// one token, as its real cost is only known once the caller is authenticated.
+func PreAuthRateLimiterMiddleware(cfg *config.Config, logger *zap.Logger, limiter *ratelimit.Limiter) gin.HandlerFunc {
+	if !limiter.Enabled() || limiter.PreAuth() == nil {
 		return func(c *gin.Context) {
 			c.Next()
 		}
 	}
 
-	// If Redis is reachable, create a new rate limiter using the Redis client
-	limiter := redis_rate.NewLimiter(redisClient)
-
-	// Calculate how many requests per second are allowed
-	// Example: if the config says 60 requests per 1 minute, it becomes 1 request per second
-	rps := int(float64(cfg.RateLimiting.Limit) / cfg.RateLimiting.Window.Seconds())
+	policy := limiter.PreAuth()
+	return func(c *gin.Context) {
+		identity := rateLimitIdentity(c, policy, nil, cfg.ClientIP.IPv6PrefixLength)
+		enforceRateLimit(c, cfg, logger, limiter, policy, identity, policy.Rate, 1)
+	}
+}
 
-	// Log the rate limiting configuration
-	logger.Info("Redis rate limiter initialized",
-		zap.Int("requestsPerSecond", rps),
-		zap.Int("limit", cfg.RateLimiting.Limit),
-		zap.Duration("window", cfg.RateLimiting.Window),
-	)
+// enforceRateLimit counts the request against the policy and either continues
+// the chain or aborts it with 429, or 503 when the policy fails closed
+func enforceRateLimit(c *gin.Context, cfg *config.Config, logger *zap.Logger, limiter *ratelimit.Limiter,
+	policy *ratelimit.Policy, identity string, rate ratelimit.Rate, cost int) {
+	if cost < 1 {
+		// A request costing nothing, or less, would pass for free or refill the budget
+		logger.Error("Invalid rate limit cost", zap.Int("cost", cost), zap.String("policy", policy.Name))
+		c.Error(apiErrors.InternalError("Invalid rate limit cost", nil))
+		c.Abort()
+		return
+	}
+	if capacity := policy.Capacity(rate); cost > capacity {
+		// Waiting would not help, so the client gets no Retry-After
+		logger.Warn("Request cost exceeds rate limit capacity",
+			zap.String("policy", policy.Name),
+			zap.String("identity", identity),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("cost", cost),
+			zap.Int("capacity", capacity),
+		)
+		c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeBadRequest, "Request is too expensive for the rate limit",
+			map[string]interface{}{
+				"code":     constants.ErrorCodeCostExceedsCapacity,
+				"policy":   policy.Name,
+				"cost":     cost,
+				"capacity": capacity,
+			}, nil))
+		c.Abort()
+		return
+	}
 
-	// Return the actual middleware function
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP() // Get the IP address of the client
-		key := "rl:" + clientIP  // Generate a Redis key using the IP (e.g., "rl:192.168.1.1")
-
-		// Ask the limiter if this client/IP can make a request now
-		res, err := limiter.Allow(c.Request.Context(), key, redis_rate.PerSecond(rps))
-
-		if err != nil {
-			// If Redis has an error, just allow the request but log it
-			logger.Error("Rate limiter Redis error",
-				zap.Error(err),
-				zap.String("clientIP", clientIP),
-			)
-			c.Next()
+	// Ask the limiter if this caller can make a request now
+	res, err := limiter.Allow(c.Request.Context(), policy, identity, rate, cost)
+	if errors.Is(err, ratelimit.ErrUnavailable) {
+		// Redis is down and the policy does not fall back to memory
+		if policy.FailureMode == ratelimit.FailureModeClosed {
+			c.Error(apiErrors.ServiceUnavailableError("Rate limiter unavailable", err))
+			c.Abort()
 			return
 		}
+		c.Next()
+		return
+	}
+	if err != nil {
+		// If Redis has an error, just allow the request but log it
+		logger.Error("Rate limiter Redis error",
+			zap.Error(err),
+			zap.String("policy", policy.Name),
+			zap.String("identity", identity),
+		)
+		c.Next()
+		return
+	}
 
-		// Add rate limit headers to response with proper values
-		// These headers help clients understand how many requests they have left and when the limit will reset
-		c.Header("X-RateLimit-Limit", strconv.Itoa(rps))                                    // Total allowed requests per second
+	// Add rate limit headers to response with proper values
+	// These headers help clients understand how many requests they have left and when the limit will reset
+	writeRateLimitHeaders(c, cfg.RateLimiting.Headers, policy, rate, res)
+
+	// If not allowed (i.e., rate limit exceeded), block the request
+	if !res.Allowed {
+		// Log that the caller has exceeded the limit
+		logger.Warn("Rate limit exceeded",
+			zap.String("policy", policy.Name),
+			zap.String("identity", identity),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("cost", cost),
+		)
+
+		// Tell the client when to retry, in the header and in the error details
+		c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+		c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeRateLimited, "Rate limit exceeded",
+			map[string]interface{}{
+				"code":     constants.ErrorCodeRateLimited,
+				"policy":   policy.Name,
+				"limit":    res.Limit,
+				"cost":     cost,
+				"window":   rate.Window.Std().String(),
+				"reset_at": time.Now().Add(res.ResetAfter).UTC().Format(time.RFC3339),
+			}, nil))
+		c.Abort() // Stop further processing of the request
+		return
+	}
+
+	// If allowed, continue to the next handler in the middleware chain
+	c.Next()
+}
+
+// rateLimitIdentity builds the counter key from the policy's key parts, e.g.
+// "user:42" or "ip:203.0.113.7|user:42". Identity parts fall back to the
+// client IP for callers that do not have them. IPv6 clients are counted by
+// their prefix, as one host can use every address in it.
+func rateLimitIdentity(c *gin.Context, policy *ratelimit.Policy, claims *UserClaims, ipv6PrefixLength int) string {
+	parts := make([]string, 0, 2)
+	seen := make(map[string]bool, 2)
+	add := func(part string) {
+		if !seen[part] {
+			seen[part] = true
+			parts = append(parts, part)
+		}
+	}
+
+	for _, keyPart := range policy.KeyParts() {
+		switch {
+		case keyPart == ratelimit.KeyAPIKey && claims != nil && claims.APIKeyID != "":
+			add(ratelimit.IdentityPart(ratelimit.KeyAPIKey, claims.APIKeyID))
+		case keyPart != ratelimit.KeyIP && claims != nil && claims.UserID != "":
+			add(ratelimit.IdentityPart(ratelimit.KeyUser, claims.UserID))
+		default:
+			add(ratelimit.IdentityPart(ratelimit.KeyIP, ratelimit.GroupIP(c.ClientIP(), ipv6PrefixLength)))
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+// writeRateLimitHeaders sets the legacy X-RateLimit-* headers, the IETF
+// RateLimit and RateLimit-Policy fields, or both
+func writeRateLimitHeaders(c *gin.Context, mode string, policy *ratelimit.Policy, rate ratelimit.Rate, res ratelimit.Result) {
+	if mode == "legacy" || mode == "both" {
+		c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))                              // Requests allowed per window
 		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))                      // How many requests are left
-		c.Header("X-RateLimit-Reset", strconv.FormatInt(res.ResetAfter.Milliseconds(), 10)) // Time left to reset limit
-
-		// If not allowed (i.e., rate limit exceeded), block the request
-		if res.Allowed <= 0 {
-			// Log that the client has exceeded the limit
-			logger.Warn("Rate limit exceeded",
-				zap.String("clientIP", clientIP),
-				zap.String("path", c.Request.URL.Path),
-			)
-
-			// Create a rate-limited error using the custom error package
-			apiErr := errors.RateLimitedError("Rate limit exceeded")
-			c.Error(apiErr) // Attach the error to the Gin context
-			c.Abort()       // Stop further processing of the request
-			return
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(res.ResetAfter.Milliseconds(), 10)) // Milliseconds until the limit resets
+	}
+	if mode == "ietf" || mode == "both" {
+		// e.g. RateLimit-Policy: "login";q=5;w=60 and RateLimit: "login";r=3;t=36
+		name := structuredString(policy.Name)
+		c.Header("RateLimit-Policy", fmt.Sprintf("%s;q=%d;w=%d", name, res.Limit, ceilSeconds(rate.Window.Std())))
+		c.Header("RateLimit", fmt.Sprintf("%s;r=%d;t=%d", name, res.Remaining, ceilSeconds(res.ResetAfter)))
+	}
+}
+
+// structuredString quotes s as a structured field string (RFC 8941)
+func structuredString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
 		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
 
-		// If allowed, continue to the next handler in the middleware chain
-		c.Next()
+// ceilSeconds rounds a duration up to whole seconds, for headers that count in seconds
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
 	}
+	return int((d + time.Second - 1) / time.Second)
 }
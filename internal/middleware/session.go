@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+)
+
+// bufferedResponseWriter holds the response body in memory so it can be
+// inspected and rewritten before anything is sent to the client
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// SessionCookieMiddleware intercepts successful login and refresh responses and
+// stores the tokens in HttpOnly cookies, so the web frontend never has to keep
+// them in JavaScript-accessible storage. The refresh token cookie is scoped to
+// the refresh route, and the refresh token is always removed from the body.
+func SessionCookieMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	// Without cookie mode the login response is passed through untouched
+	if !cfg.Session.CookieMode {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		// Capture the upstream response instead of streaming it to the client
+		writer := &bufferedResponseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+
+		c.Next()
+
+		// Restore the original writer so the (possibly rewritten) body can be sent
+		c.Writer = writer.ResponseWriter
+		body := writer.body.Bytes()
+
+		status := c.Writer.Status()
+		if status >= http.StatusOK && status < http.StatusMultipleChoices {
+			rewritten, err := setSessionCookies(c, cfg, body)
+			if err != nil {
+				// Leave the response as-is; the client still receives its tokens in the body
+				logger.Warn("Failed to set session cookies from login response", zap.Error(err))
+			} else {
+				body = rewritten
+			}
+		}
+
+		c.Writer.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		c.Writer.Write(body)
+	}
+}
+
+// setSessionCookies reads the tokens from the login response body, sets them as
+// cookies together with a CSRF token and returns the body to send to the client
+func setSessionCookies(c *gin.Context, cfg *config.Config, body []byte) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("login response is not a JSON object: %w", err)
+	}
+
+	// auth-service may return the tokens at the top level or inside "data"
+	tokens := payload
+	if _, ok := tokens[constants.FieldAccessToken]; !ok {
+		if data, ok := payload["data"].(map[string]interface{}); ok {
+			tokens = data
+		}
+	}
+
+	accessToken, _ := tokens[constants.FieldAccessToken].(string)
+	if accessToken == "" {
+		return nil, fmt.Errorf("login response does not contain an access token")
+	}
+
+	c.SetSameSite(SameSiteMode(cfg.Session.CookieSameSite))
+	c.SetCookie(cfg.Session.AccessCookieName, accessToken, cfg.JWT.ExpirationHours*3600,
+		cfg.Session.CookiePath, cfg.Session.CookieDomain, cfg.Session.CookieSecure, true)
+
+	// The long-lived refresh token is only ever sent to the refresh route
+	refreshToken, _ := tokens[constants.FieldRefreshToken].(string)
+	if refreshToken != "" {
+		c.SetCookie(cfg.Session.RefreshCookieName, refreshToken, cfg.JWT.RefreshExpHours*3600,
+			cfg.Session.RefreshCookiePath, cfg.Session.CookieDomain, cfg.Session.CookieSecure, true)
+		delete(tokens, constants.FieldRefreshToken)
+	}
+
+	// Issue the CSRF token that must accompany state-changing requests
+	csrfToken, err := issueCSRFToken(c, cfg, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	c.Header(constants.HeaderCSRFToken, csrfToken)
+
+	// Remove the access token from the body as well, so it never reaches JavaScript
+	if cfg.Session.StripTokens {
+		delete(tokens, constants.FieldAccessToken)
+	}
+	return json.Marshal(payload)
+}
+
+// RefreshCookieMiddleware passes the refresh token cookie to auth-service in
+// the body of refresh requests, where it expects the token. A token sent in
+// the body takes precedence.
+func RefreshCookieMiddleware(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refreshToken, err := c.Cookie(cfg.Session.RefreshCookieName)
+		if err != nil || refreshToken == "" {
+			c.Next()
+			return
+		}
+
+		body, err := peekJSONBody(c)
+		if err != nil {
+			c.Error(apiErrors.BadRequestError("Invalid request body", err))
+			c.Abort()
+			return
+		}
+		if token, _ := body[constants.FieldRefreshToken].(string); token == "" {
+			body[constants.FieldRefreshToken] = refreshToken
+			data, err := json.Marshal(body)
+			if err != nil {
+				c.Error(apiErrors.InternalError("Failed to forward refresh token", err))
+				c.Abort()
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			c.Request.ContentLength = int64(len(data))
+			c.Request.Header.Set(constants.HeaderContentType, constants.HeaderApplicationJSON)
+			logger.Debug("Refresh token taken from session cookie")
+		}
+
+		c.Next()
+	}
+}
+
+// issueCSRFToken creates a CSRF token for the session. In double-submit mode the
+// token is random and mirrored in a readable cookie; in synchronizer mode it is
+// derived from the access token and only returned in the response header.
+func issueCSRFToken(c *gin.Context, cfg *config.Config, accessToken string) (string, error) {
+	if cfg.Session.CSRFMode == constants.CSRFModeSynchronizer {
+		return synchronizerToken(cfg, accessToken), nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	// Not HttpOnly: the frontend reads it and echoes it back in the header
+	c.SetSameSite(SameSiteMode(cfg.Session.CookieSameSite))
+	c.SetCookie(cfg.Session.CSRFCookieName, token, cfg.JWT.ExpirationHours*3600,
+		cfg.Session.CookiePath, cfg.Session.CookieDomain, cfg.Session.CookieSecure, false)
+	return token, nil
+}
+
+// synchronizerToken binds a CSRF token to the session's access token
+func synchronizerToken(cfg *config.Config, accessToken string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.Session.CSRFSecret))
+	mac.Write([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCSRF checks the CSRF token of a cookie-authenticated request
+func verifyCSRF(c *gin.Context, cfg *config.Config, accessToken string) *apiErrors.APIError {
+	if isSafeMethod(c.Request.Method) {
+		return nil
+	}
+
+	headerToken := c.GetHeader(constants.HeaderCSRFToken)
+	if headerToken == "" {
+		return apiErrors.New(apiErrors.ErrorTypeForbidden, "CSRF token missing", nil)
+	}
+
+	var expected string
+	if cfg.Session.CSRFMode == constants.CSRFModeSynchronizer {
+		expected = synchronizerToken(cfg, accessToken)
+	} else {
+		cookieToken, err := c.Cookie(cfg.Session.CSRFCookieName)
+		if err != nil || cookieToken == "" {
+			return apiErrors.New(apiErrors.ErrorTypeForbidden, "CSRF cookie missing", err)
+		}
+		expected = cookieToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(headerToken), []byte(expected)) != 1 {
+		return apiErrors.New(apiErrors.ErrorTypeForbidden, "CSRF token mismatch", nil)
+	}
+	return nil
+}
+
+// CSRFTokenHandler returns the CSRF token for the current cookie session so the
+// frontend can recover it after a page reload
+func CSRFTokenHandler(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accessToken, err := c.Cookie(cfg.Session.AccessCookieName)
+		if err != nil || accessToken == "" {
+			logger.Debug("CSRF token requested without a session cookie")
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "Authentication required", err))
+			return
+		}
+
+		var token string
+		if cfg.Session.CSRFMode == constants.CSRFModeSynchronizer {
+			token = synchronizerToken(cfg, accessToken)
+		} else if token, err = c.Cookie(cfg.Session.CSRFCookieName); err != nil || token == "" {
+			// Re-issue a double-submit token if the cookie was lost
+			if token, err = issueCSRFToken(c, cfg, accessToken); err != nil {
+				c.Error(apiErrors.InternalError("Failed to issue CSRF token", err))
+				return
+			}
+		}
+
+		c.Header(constants.HeaderCSRFToken, token)
+		c.JSON(http.StatusOK, gin.H{"csrf_token": token})
+	}
+}
+
+// LogoutHandler clears the session cookies. The tokens are HttpOnly, so the
+// frontend cannot remove them itself.
+func LogoutHandler(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.SetSameSite(SameSiteMode(cfg.Session.CookieSameSite))
+		c.SetCookie(cfg.Session.AccessCookieName, "", -1,
+			cfg.Session.CookiePath, cfg.Session.CookieDomain, cfg.Session.CookieSecure, true)
+		c.SetCookie(cfg.Session.RefreshCookieName, "", -1,
+			cfg.Session.RefreshCookiePath, cfg.Session.CookieDomain, cfg.Session.CookieSecure, true)
+		c.SetCookie(cfg.Session.CSRFCookieName, "", -1,
+			cfg.Session.CookiePath, cfg.Session.CookieDomain, cfg.Session.CookieSecure, false)
+
+		logger.Debug("Session cookies cleared")
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Logged out"})
+	}
+}
+
+// SameSiteMode converts the configured SameSite value into its http constant
+func SameSiteMode(value string) http.SameSite {
+	switch value {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+// isSafeMethod reports whether the HTTP method does not change server state
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+)
+
+// StepUpRequirement is the authentication context a route requires
+type StepUpRequirement struct {
+	ACRValues []string      // Accepted acr values, e.g. "mfa"; empty accepts any
+	AMRValues []string      // Accepted amr methods, e.g. "otp"; empty accepts any
+	MaxAge    time.Duration // Maximum time since auth_time; zero disables the check
+}
+
+// StepUpMiddleware creates a middleware that rejects tokens whose authentication
+// is too weak or too old for the route. The 401 response tells the client how to
+// re-authenticate (RFC 9470). It must run after authentication.
+func StepUpMiddleware(logger *zap.Logger, requirement StepUpRequirement) gin.HandlerFunc {
+	challenge := stepUpChallenge(requirement)
+
+	return func(c *gin.Context) {
+		claims, ok := userClaimsFromContext(c)
+		if !ok {
+			logger.Debug("User claims not found in context")
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "User claims not found", nil))
+			c.Abort()
+			return
+		}
+
+		reason := ""
+		switch {
+		case len(requirement.ACRValues) > 0 && !containsString(requirement.ACRValues, claims.ACR):
+			reason = "authentication context class is not sufficient"
+		case len(requirement.AMRValues) > 0 && !containsAnyString(claims.AMR, requirement.AMRValues):
+			reason = "authentication method is not sufficient"
+		case requirement.MaxAge > 0 && (claims.AuthTime == nil || time.Since(claims.AuthTime.Time) > requirement.MaxAge):
+			reason = "authentication is too old"
+		}
+
+		if reason != "" {
+			logger.Debug("Step-up authentication required",
+				zap.String("user_id", claims.UserID),
+				zap.String("acr", claims.ACR),
+				zap.String("reason", reason))
+
+			c.Header("WWW-Authenticate", challenge)
+			c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeUnauthorized, "Step-up authentication required",
+				map[string]interface{}{
+					"code":       constants.ErrorCodeStepUpRequired,
+					"reason":     reason,
+					"acr_values": requirement.ACRValues,
+					"amr_values": requirement.AMRValues,
+					"max_age":    int(requirement.MaxAge.Seconds()),
+				}, nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// stepUpChallenge builds the WWW-Authenticate header value for the requirement
+func stepUpChallenge(requirement StepUpRequirement) string {
+	parts := []string{
+		`Bearer error="insufficient_user_authentication"`,
+		`error_description="A stronger or more recent authentication is required"`,
+	}
+	if len(requirement.ACRValues) > 0 {
+		parts = append(parts, fmt.Sprintf(`acr_values="%s"`, strings.Join(requirement.ACRValues, " ")))
+	}
+	if requirement.MaxAge > 0 {
+		parts = append(parts, fmt.Sprintf(`max_age=%d`, int(requirement.MaxAge.Seconds())))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyString(values, wanted []string) bool {
+	for _, w := range wanted {
+		if containsString(values, w) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidState is returned when the flow state cookie is missing, tampered with or expired
+var ErrInvalidState = errors.New("invalid or expired OIDC state")
+
+// FlowState is the per-login data kept between the authorization redirect and
+// the callback. It is stored client-side in a signed cookie so the gateway
+// stays stateless.
+type FlowState struct {
+	Provider  string `json:"provider"`
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// EncodeState serializes and signs the flow state
+func EncodeState(secret string, state FlowState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(secret, encoded), nil
+}
+
+// DecodeState verifies the signature and expiry of an encoded flow state
+func DecodeState(secret, value string) (*FlowState, error) {
+	encoded, signature, found := strings.Cut(value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(sign(secret, encoded))) {
+		return nil, ErrInvalidState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+
+	var state FlowState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, ErrInvalidState
+	}
+	if time.Now().Unix() > state.ExpiresAt {
+		return nil, ErrInvalidState
+	}
+	return &state, nil
+}
+
+func sign(secret, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,243 @@
+// Package outbound caps the traffic the gateway forwards to each upstream
+// service at a rate and a number of requests in flight. Requests over the caps
+// wait in a bounded FIFO queue and are rejected when it is full or their wait
+// times out, so an upstream never receives more than it was sized for.
+package outbound
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+)
+
+// Rejection reasons, reported in error details and stats
+var (
+	ErrQueueFull    = errors.New("queue_full")
+	ErrQueueTimeout = errors.New("queue_timeout")
+)
+
+// Stats is a snapshot of an upstream's limits, for monitoring
+type Stats struct {
+	Upstream      string  `json:"upstream"`
+	Rate          float64 `json:"rate,omitempty"`
+	MaxConcurrent int     `json:"max_concurrent,omitempty"`
+	Inflight      int     `json:"inflight"`
+	QueueDepth    int     `json:"queue_depth"`
+	QueueSize     int     `json:"queue_size"`
+	Admitted      uint64  `json:"admitted"`         // Requests forwarded since startup
+	Queued        uint64  `json:"queued"`           // Requests that had to wait before being forwarded or rejected
+	QueueFull     uint64  `json:"rejected_full"`    // Requests rejected because the queue was full
+	QueueTimeout  uint64  `json:"rejected_timeout"` // Requests rejected after waiting QueueTimeout
+	Cancelled     uint64  `json:"cancelled"`        // Requests whose client went away while queued
+}
+
+// waiter is a queued request; ready is closed once it is admitted
+type waiter struct {
+	ready    chan struct{}
+	admitted bool
+}
+
+// Gate enforces the limits of one upstream
+type Gate struct {
+	name string
+	cfg  config.UpstreamLimitConfig
+
+	mu       sync.Mutex
+	tokens   float64
+	burst    float64
+	refilled time.Time
+	inflight int
+	queue    []*waiter
+	wakeup   *time.Timer // Pending dispatch for when the next token is available
+
+	admitted, queued, queueFull, queueTimeout, cancelled uint64
+}
+
+func newGate(name string, cfg config.UpstreamLimitConfig) *Gate {
+	burst := float64(cfg.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(cfg.Rate))
+	}
+	return &Gate{
+		name:     name,
+		cfg:      cfg,
+		tokens:   burst,
+		burst:    burst,
+		refilled: time.Now(),
+	}
+}
+
+// Acquire admits a request, waiting in the queue if the upstream is at its
+// caps. Admitted requests must call the returned release function when the
+// upstream has answered.
+func (g *Gate) Acquire(ctx context.Context) (release func(), err error) {
+	g.mu.Lock()
+	if len(g.queue) == 0 && g.canAdmit(time.Now()) {
+		g.admit()
+		g.mu.Unlock()
+		return g.release, nil
+	}
+	if len(g.queue) >= g.cfg.QueueSize {
+		g.queueFull++
+		g.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	g.queue = append(g.queue, w)
+	g.queued++
+	g.scheduleWakeup(time.Now())
+	g.mu.Unlock()
+
+	timer := time.NewTimer(g.cfg.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-w.ready:
+		return g.release, nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if w.admitted {
+		// Admitted while the timeout fired; the slot is ours to use
+		return g.release, nil
+	}
+	g.remove(w)
+	if err == ErrQueueTimeout {
+		g.queueTimeout++
+	} else {
+		g.cancelled++
+	}
+	return nil, err
+}
+
+// Stats returns a snapshot of the gate's state and counters
+func (g *Gate) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return Stats{
+		Upstream:      g.name,
+		Rate:          g.cfg.Rate,
+		MaxConcurrent: g.cfg.MaxConcurrent,
+		Inflight:      g.inflight,
+		QueueDepth:    len(g.queue),
+		QueueSize:     g.cfg.QueueSize,
+		Admitted:      g.admitted,
+		Queued:        g.queued,
+		QueueFull:     g.queueFull,
+		QueueTimeout:  g.queueTimeout,
+		Cancelled:     g.cancelled,
+	}
+}
+
+// release ends a request and hands its slot to the queue
+func (g *Gate) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.inflight--
+	g.dispatch()
+}
+
+// canAdmit refills the token bucket and reports whether both caps have room
+func (g *Gate) canAdmit(now time.Time) bool {
+	if g.cfg.Rate > 0 {
+		g.tokens = math.Min(g.burst, g.tokens+now.Sub(g.refilled).Seconds()*g.cfg.Rate)
+		g.refilled = now
+		if g.tokens < 1 {
+			return false
+		}
+	}
+	return g.cfg.MaxConcurrent <= 0 || g.inflight < g.cfg.MaxConcurrent
+}
+
+func (g *Gate) admit() {
+	if g.cfg.Rate > 0 {
+		g.tokens--
+	}
+	g.inflight++
+	g.admitted++
+}
+
+// dispatch admits queued requests in order while there is room
+func (g *Gate) dispatch() {
+	now := time.Now()
+	for len(g.queue) > 0 && g.canAdmit(now) {
+		w := g.queue[0]
+		g.queue = g.queue[1:]
+		g.admit()
+		w.admitted = true
+		close(w.ready)
+	}
+	g.scheduleWakeup(now)
+}
+
+// scheduleWakeup dispatches again when the next token is due, if queued
+// requests are waiting for the rate rather than for a request to finish
+func (g *Gate) scheduleWakeup(now time.Time) {
+	if len(g.queue) == 0 || g.cfg.Rate <= 0 || g.tokens >= 1 || g.wakeup != nil {
+		return
+	}
+	wait := time.Duration((1 - g.tokens) / g.cfg.Rate * float64(time.Second))
+	g.wakeup = time.AfterFunc(wait, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		g.wakeup = nil
+		g.dispatch()
+	})
+}
+
+func (g *Gate) remove(w *waiter) {
+	for i, queued := range g.queue {
+		if queued == w {
+			g.queue = append(g.queue[:i], g.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// Limiter holds the gates of the upstreams that have limits configured
+type Limiter struct {
+	gates map[string]*Gate
+}
+
+// NewLimiter creates a gate for every upstream with a rate or concurrency cap
+func NewLimiter(cfg config.OutboundConfig) *Limiter {
+	limiter := &Limiter{gates: make(map[string]*Gate)}
+	if !cfg.Enabled {
+		return limiter
+	}
+	for name, limit := range cfg.Upstreams {
+		if limit.Rate > 0 || limit.MaxConcurrent > 0 {
+			limiter.gates[name] = newGate(name, limit)
+		}
+	}
+	return limiter
+}
+
+// Gate returns the gate of an upstream, or nil if it is not limited
+func (l *Limiter) Gate(upstream string) *Gate {
+	return l.gates[upstream]
+}
+
+// Stats returns the stats of every limited upstream, sorted by name
+func (l *Limiter) Stats() []Stats {
+	stats := make([]Stats, 0, len(l.gates))
+	for _, gate := range l.gates {
+		stats = append(stats, gate.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Upstream < stats[j].Upstream })
+	return stats
+}
@@ -0,0 +1,151 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+)
+
+func mustAcquire(t *testing.T, g *Gate) func() {
+	t.Helper()
+	release, err := g.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	return release
+}
+
+// waitForQueue waits until n requests are queued at the gate
+func waitForQueue(t *testing.T, g *Gate, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for g.Stats().QueueDepth != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth = %d, want %d", g.Stats().QueueDepth, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGateQueuesInOrder(t *testing.T) {
+	g := newGate("user", config.UpstreamLimitConfig{MaxConcurrent: 1, QueueSize: 2, QueueTimeout: time.Second})
+	release := mustAcquire(t, g)
+
+	admitted := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		go func() {
+			next, err := g.Acquire(context.Background())
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				admitted <- 0
+				return
+			}
+			admitted <- i
+			next()
+		}()
+		waitForQueue(t, g, i)
+	}
+
+	release()
+	for want := 1; want <= 2; want++ {
+		if got := <-admitted; got != want {
+			t.Errorf("admitted request %d, want %d", got, want)
+		}
+	}
+
+	stats := g.Stats()
+	if stats.Admitted != 3 || stats.Queued != 2 || stats.Inflight != 0 || stats.QueueDepth != 0 {
+		t.Errorf("stats = %+v, want 3 admitted, 2 queued, none in flight or queued", stats)
+	}
+}
+
+func TestGateRejectsWhenQueueFull(t *testing.T) {
+	g := newGate("user", config.UpstreamLimitConfig{MaxConcurrent: 1, QueueSize: 1, QueueTimeout: time.Second})
+	release := mustAcquire(t, g)
+	defer release()
+
+	go g.Acquire(context.Background())
+	waitForQueue(t, g, 1)
+
+	if _, err := g.Acquire(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Acquire() error = %v, want %v", err, ErrQueueFull)
+	}
+	if stats := g.Stats(); stats.QueueFull != 1 {
+		t.Errorf("rejected_full = %d, want 1", stats.QueueFull)
+	}
+}
+
+func TestGateTimesOutQueuedRequests(t *testing.T) {
+	g := newGate("user", config.UpstreamLimitConfig{MaxConcurrent: 1, QueueSize: 1, QueueTimeout: 20 * time.Millisecond})
+	release := mustAcquire(t, g)
+	defer release()
+
+	start := time.Now()
+	if _, err := g.Acquire(context.Background()); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("Acquire() error = %v, want %v", err, ErrQueueTimeout)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("timed out after %s, want at least 20ms", waited)
+	}
+
+	stats := g.Stats()
+	if stats.QueueTimeout != 1 || stats.QueueDepth != 0 || stats.Inflight != 1 {
+		t.Errorf("stats = %+v, want 1 timeout, empty queue, 1 in flight", stats)
+	}
+}
+
+func TestGateCancelledWhileQueued(t *testing.T) {
+	g := newGate("user", config.UpstreamLimitConfig{MaxConcurrent: 1, QueueSize: 1, QueueTimeout: time.Second})
+	release := mustAcquire(t, g)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire() error = %v, want %v", err, context.Canceled)
+	}
+	if stats := g.Stats(); stats.Cancelled != 1 || stats.QueueDepth != 0 {
+		t.Errorf("stats = %+v, want 1 cancelled and an empty queue", stats)
+	}
+}
+
+func TestGatePacesRate(t *testing.T) {
+	// A burst of 2 at 50 requests per second: the third request waits about 20ms
+	g := newGate("auth", config.UpstreamLimitConfig{Rate: 50, Burst: 2, QueueSize: 1, QueueTimeout: time.Second})
+	mustAcquire(t, g)()
+	mustAcquire(t, g)()
+
+	start := time.Now()
+	mustAcquire(t, g)()
+	if waited := time.Since(start); waited < 10*time.Millisecond || waited > 500*time.Millisecond {
+		t.Errorf("third request waited %s, want about 20ms", waited)
+	}
+	if stats := g.Stats(); stats.Queued != 1 || stats.Admitted != 3 {
+		t.Errorf("stats = %+v, want 3 admitted, 1 queued", stats)
+	}
+}
+
+func TestNewLimiterSkipsUnlimitedUpstreams(t *testing.T) {
+	limiter := NewLimiter(config.OutboundConfig{
+		Enabled: true,
+		Upstreams: map[string]config.UpstreamLimitConfig{
+			"auth":  {Rate: 10},
+			"user":  {MaxConcurrent: 5},
+			"admin": {QueueSize: 100},
+		},
+	})
+	if limiter.Gate("auth") == nil || limiter.Gate("user") == nil {
+		t.Error("limited upstreams have no gate")
+	}
+	if limiter.Gate("admin") != nil {
+		t.Error("upstream without caps has a gate")
+	}
+
+	disabled := NewLimiter(config.OutboundConfig{Upstreams: map[string]config.UpstreamLimitConfig{"auth": {Rate: 10}}})
+	if disabled.Gate("auth") != nil {
+		t.Error("disabled limiter has a gate")
+	}
+}
@@ -0,0 +1,358 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// Rule effects
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Document is the policy file. Rules are evaluated in order and the first rule
+// whose route and conditions match decides the request.
+type Document struct {
+	DryRun        bool   `json:"dry_run"`        // Log decisions without enforcing them
+	DefaultEffect string `json:"default_effect"` // Effect for routes no rule covers, defaults to allow
+	Rules         []Rule `json:"rules"`
+}
+
+// Rule maps routes and methods to the conditions a request must satisfy
+type Rule struct {
+	Name    string   `json:"name"`
+	Effect  string   `json:"effect"`  // allow or deny
+	Methods []string `json:"methods"` // Empty matches every method
+	Paths   []string `json:"paths"`   // Path patterns; "*" matches a segment, a trailing "/*" a subtree
+
+	// Conditions; all configured conditions must hold for the rule to apply
+	Roles      []string                 `json:"roles"`   // Caller has any of these roles
+	Scopes     []string                 `json:"scopes"`  // Caller has all of these scopes
+	Claims     map[string][]interface{} `json:"claims"`  // Claim equals one of the values, e.g. {"plan": ["gold"]}
+	Headers    map[string][]string      `json:"headers"` // Request header equals one of the values
+	Query      map[string][]string      `json:"query"`   // Query parameter equals one of the values
+	TimeWindow *TimeWindow              `json:"time_window"`
+}
+
+// TimeWindow restricts a rule to certain days and hours
+type TimeWindow struct {
+	Days     []string `json:"days"`     // Weekday names such as "mon" or "monday"; empty means every day
+	Start    string   `json:"start"`    // "HH:MM", inclusive; empty means midnight
+	End      string   `json:"end"`      // "HH:MM", exclusive; empty means the end of the day. May be earlier than Start to span midnight
+	Timezone string   `json:"timezone"` // IANA zone, defaults to UTC
+
+	location *time.Location
+}
+
+// Input describes the request and the authenticated caller
+type Input struct {
+	Method  string
+	Path    string
+	Roles   []string
+	Scopes  []string
+	Claim   func(name string) (interface{}, bool)
+	Headers http.Header
+	Query   url.Values
+	Time    time.Time
+}
+
+// Decision is the outcome of evaluating a request
+type Decision struct {
+	Allowed bool     `json:"allowed"`
+	Rule    string   `json:"rule,omitempty"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Engine evaluates requests against a policy document
+type Engine struct {
+	doc Document
+}
+
+// LoadFile reads and validates a policy document from a JSON file
+func LoadFile(file string) (*Engine, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	return NewEngine(doc)
+}
+
+// NewEngine validates a policy document and creates an engine for it
+func NewEngine(doc Document) (*Engine, error) {
+	if doc.DefaultEffect == "" {
+		doc.DefaultEffect = EffectAllow
+	}
+	if doc.DefaultEffect != EffectAllow && doc.DefaultEffect != EffectDeny {
+		return nil, fmt.Errorf("invalid default_effect %q", doc.DefaultEffect)
+	}
+
+	for i := range doc.Rules {
+		rule := &doc.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+			return nil, fmt.Errorf("rule %s: invalid effect %q", rule.Name, rule.Effect)
+		}
+		if len(rule.Paths) == 0 {
+			return nil, fmt.Errorf("rule %s: at least one path is required", rule.Name)
+		}
+		if rule.TimeWindow != nil {
+			if err := rule.TimeWindow.init(); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		}
+	}
+	return &Engine{doc: doc}, nil
+}
+
+// DryRun reports whether the document asks for decisions to be logged only
+func (e *Engine) DryRun() bool {
+	return e.doc.DryRun
+}
+
+// Evaluate decides whether the request is allowed
+func (e *Engine) Evaluate(input Input) Decision {
+	var reasons []string
+	covered := false
+
+	for _, rule := range e.doc.Rules {
+		if !rule.matchesRoute(input.Method, input.Path) {
+			continue
+		}
+		covered = true
+
+		failed := rule.unmetConditions(input)
+		if len(failed) > 0 {
+			for _, reason := range failed {
+				reasons = append(reasons, rule.Name+": "+reason)
+			}
+			continue
+		}
+
+		if rule.Effect == EffectDeny {
+			return Decision{Allowed: false, Rule: rule.Name, Reasons: []string{"denied by rule " + rule.Name}}
+		}
+		return Decision{Allowed: true, Rule: rule.Name, Reasons: []string{"allowed by rule " + rule.Name}}
+	}
+
+	if covered {
+		// The route is governed by the policy but no rule granted access
+		return Decision{Allowed: false, Reasons: reasons}
+	}
+
+	if e.doc.DefaultEffect == EffectDeny {
+		return Decision{Allowed: false, Reasons: []string{"no rule matches the route"}}
+	}
+	return Decision{Allowed: true, Reasons: []string{"no rule matches the route"}}
+}
+
+// matchesRoute reports whether the rule covers the method and path
+func (r Rule) matchesRoute(method, requestPath string) bool {
+	if len(r.Methods) > 0 {
+		methodMatches := false
+		for _, m := range r.Methods {
+			if m == "*" || strings.EqualFold(m, method) {
+				methodMatches = true
+				break
+			}
+		}
+		if !methodMatches {
+			return false
+		}
+	}
+
+	for _, pattern := range r.Paths {
+		if utils.MatchPath(pattern, requestPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmetConditions returns a reason for every condition the request does not satisfy
+func (r Rule) unmetConditions(input Input) []string {
+	var failed []string
+
+	if len(r.Roles) > 0 && !containsAny(input.Roles, r.Roles) {
+		failed = append(failed, fmt.Sprintf("requires one of roles %v", r.Roles))
+	}
+
+	for _, scope := range r.Scopes {
+		if !containsAny(input.Scopes, []string{scope}) {
+			failed = append(failed, fmt.Sprintf("requires scope %s", scope))
+		}
+	}
+
+	for name, allowed := range r.Claims {
+		var value interface{}
+		found := false
+		if input.Claim != nil {
+			value, found = input.Claim(name)
+		}
+		if !found || !valueMatches(value, allowed) {
+			failed = append(failed, fmt.Sprintf("claim %s must be one of %v", name, allowed))
+		}
+	}
+
+	for name, allowed := range r.Headers {
+		if !stringMatches(input.Headers.Get(name), allowed) {
+			failed = append(failed, fmt.Sprintf("header %s must be one of %v", name, allowed))
+		}
+	}
+
+	for name, allowed := range r.Query {
+		if !stringMatches(input.Query.Get(name), allowed) {
+			failed = append(failed, fmt.Sprintf("query parameter %s must be one of %v", name, allowed))
+		}
+	}
+
+	if r.TimeWindow != nil && !r.TimeWindow.contains(input.Time) {
+		failed = append(failed, "outside the allowed time window")
+	}
+
+	return failed
+}
+
+// init parses the time zone and validates the window bounds
+func (w *TimeWindow) init() error {
+	w.location = time.UTC
+	if w.Timezone != "" {
+		location, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", w.Timezone, err)
+		}
+		w.location = location
+	}
+	// Normalize day names to their three-letter lowercase form
+	for i, day := range w.Days {
+		short, ok := dayNames[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("invalid day %q", day)
+		}
+		w.Days[i] = short
+	}
+
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return err
+	}
+	return nil
+}
+
+// contains reports whether t falls inside the window
+func (w *TimeWindow) contains(t time.Time) bool {
+	local := t.In(w.location)
+
+	if len(w.Days) > 0 {
+		day := strings.ToLower(local.Weekday().String()[:3])
+		dayMatches := false
+		for _, d := range w.Days {
+			if d == day {
+				dayMatches = true
+				break
+			}
+		}
+		if !dayMatches {
+			return false
+		}
+	}
+
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	if w.End == "" {
+		// An open end runs to midnight
+		end = 24 * 60
+	}
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	// The window spans midnight
+	return minute >= start || minute < end
+}
+
+// dayNames maps the accepted day names to their three-letter form
+var dayNames = map[string]string{
+	"sun": "sun", "sunday": "sun",
+	"mon": "mon", "monday": "mon",
+	"tue": "tue", "tuesday": "tue",
+	"wed": "wed", "wednesday": "wed",
+	"thu": "thu", "thursday": "thu",
+	"fri": "fri", "friday": "fri",
+	"sat": "sat", "saturday": "sat",
+}
+
+// parseClock converts "HH:MM" into minutes after midnight; an empty value is midnight
+func parseClock(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// valueMatches compares a claim value, or any element of a list claim, with the allowed values
+func valueMatches(value interface{}, allowed []interface{}) bool {
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			if valueMatches(item, allowed) {
+				return true
+			}
+		}
+		return false
+	}
+	if list, ok := value.([]string); ok {
+		for _, item := range list {
+			if valueMatches(item, allowed) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, candidate := range allowed {
+		if fmt.Sprint(candidate) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringMatches(value string, allowed []string) bool {
+	for _, candidate := range allowed {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, w := range wanted {
+		for _, v := range values {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
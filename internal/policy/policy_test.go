@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	// 2026-03-02 is a Monday
+	monday := func(clock string) time.Time {
+		parsed, _ := time.Parse("2006-01-02 15:04", "2026-03-02 "+clock)
+		return parsed
+	}
+
+	tests := []struct {
+		name   string
+		window TimeWindow
+		at     time.Time
+		want   bool
+	}{
+		{"days only, matching day", TimeWindow{Days: []string{"mon"}}, monday("00:00"), true},
+		{"days only, late on matching day", TimeWindow{Days: []string{"Monday"}}, monday("23:59"), true},
+		{"days only, other day", TimeWindow{Days: []string{"tue"}}, monday("12:00"), false},
+		{"empty window", TimeWindow{}, monday("12:00"), true},
+		{"inside hours", TimeWindow{Start: "09:00", End: "17:00"}, monday("09:00"), true},
+		{"end is exclusive", TimeWindow{Start: "09:00", End: "17:00"}, monday("17:00"), false},
+		{"start only", TimeWindow{Start: "22:00"}, monday("23:30"), true},
+		{"start only, before start", TimeWindow{Start: "22:00"}, monday("21:59"), false},
+		{"end only", TimeWindow{End: "06:00"}, monday("05:59"), true},
+		{"spans midnight, late", TimeWindow{Start: "22:00", End: "06:00"}, monday("23:00"), true},
+		{"spans midnight, early", TimeWindow{Start: "22:00", End: "06:00"}, monday("05:00"), true},
+		{"spans midnight, outside", TimeWindow{Start: "22:00", End: "06:00"}, monday("12:00"), false},
+		{"timezone", TimeWindow{Start: "09:00", End: "17:00", Timezone: "Asia/Kolkata"}, monday("04:00"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.init(); err != nil {
+				t.Fatalf("init() error = %v", err)
+			}
+			if got := tt.window.contains(tt.at); got != tt.want {
+				t.Errorf("contains(%s) = %v, want %v", tt.at.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeWindowInitRejectsInvalidDays(t *testing.T) {
+	for _, day := range []string{"n m", "mo", "monxyz", "on "} {
+		window := TimeWindow{Days: []string{day}}
+		if err := window.init(); err == nil {
+			t.Errorf("init() accepted day %q", day)
+		}
+	}
+}
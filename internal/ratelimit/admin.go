@@ -0,0 +1,323 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// overridePrefix keys overrides apart from counters, whose keys start with "rl:<policy>:"
+const overridePrefix = "rloverride:"
+
+// gcraPrefix is prepended by redis_rate to the keys of GCRA counters, e.g. "rate:rl:<policy>:<identity>"
+const gcraPrefix = "rate:"
+
+// Override exempts an identity from rate limiting, or multiplies its limits, until it expires
+type Override struct {
+	Exempt     bool      `json:"exempt"`
+	Multiplier float64   `json:"multiplier,omitempty"` // Applied to limit and burst when not exempt
+	Reason     string    `json:"reason"`
+	GrantedBy  string    `json:"granted_by"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Counter is a rate limit counter stored for an identity
+type Counter struct {
+	Key       string `json:"key"`
+	Policy    string `json:"policy"`
+	Count     *int64 `json:"count,omitempty"` // Requests counted, for window and log algorithms
+	ExpiresIn int64  `json:"expires_in"`      // Seconds until Redis drops the counter
+}
+
+// State is everything the limiter stores about an identity
+type State struct {
+	Identity string    `json:"identity"`
+	Counters []Counter `json:"counters"`
+	Override *Override `json:"override,omitempty"`
+}
+
+// IdentityPart returns the part of a counter key naming a caller, e.g. "user:42"
+func IdentityPart(keyPart, value string) string {
+	switch keyPart {
+	case KeyAPIKey:
+		return "key:" + value
+	case KeyUser:
+		return "user:" + value
+	default:
+		return "ip:" + value
+	}
+}
+
+// GroupIP returns the address counters are kept for: IPv4 addresses as they
+// are, IPv6 addresses as their prefix of the given length, e.g. "2001:db8::/64"
+func GroupIP(ip string, ipv6PrefixLength int) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil || ipv6PrefixLength <= 0 || ipv6PrefixLength >= 128 {
+		return ip
+	}
+	prefix := net.IPNet{IP: parsed.Mask(net.CIDRMask(ipv6PrefixLength, 128)), Mask: net.CIDRMask(ipv6PrefixLength, 128)}
+	return prefix.String()
+}
+
+// ParseIdentity validates an identity kind (ip, user or api_key) and value from
+// the admin API. IPv6 addresses resolve to their prefix, like request counters.
+func ParseIdentity(kind, value string, ipv6PrefixLength int) (string, error) {
+	switch kind {
+	case KeyIP:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", fmt.Errorf("invalid IP address %q", value)
+		}
+		return IdentityPart(KeyIP, GroupIP(ip.String(), ipv6PrefixLength)), nil
+	case KeyUser, KeyAPIKey:
+		if value == "" {
+			return "", fmt.Errorf("%s must not be empty", kind)
+		}
+		return IdentityPart(kind, value), nil
+	default:
+		return "", fmt.Errorf("invalid kind %q, expected ip, user or api_key", kind)
+	}
+}
+
+// Inspect returns the counters and override stored for an identity. Counters
+// keyed by several parts, e.g. ip+user, are included for each part.
+func (l *Limiter) Inspect(ctx context.Context, identity string) (State, error) {
+	state := State{Identity: identity, Counters: []Counter{}}
+	if !l.available.Load() {
+		return state, ErrUnavailable
+	}
+
+	keys, err := l.counterKeys(ctx, identity)
+	if err != nil {
+		return state, err
+	}
+	for _, key := range keys {
+		counter := Counter{Key: key, Policy: policyFromKey(key)}
+		ttl, err := l.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return state, err
+		}
+		if ttl < 0 {
+			// The key expired between the scan and now
+			continue
+		}
+		counter.ExpiresIn = int64(ttl.Round(time.Second).Seconds())
+
+		switch {
+		case strings.HasSuffix(key, ":log"):
+			count, err := l.client.ZCard(ctx, key).Result()
+			if err != nil {
+				return state, err
+			}
+			counter.Count = &count
+		case strings.HasSuffix(key, ":fw") || strings.Contains(key, "}:sw:"):
+			count, err := l.client.Get(ctx, key).Int64()
+			if err != nil && err != redis.Nil {
+				return state, err
+			}
+			counter.Count = &count
+		}
+		state.Counters = append(state.Counters, counter)
+	}
+
+	override, err := l.getOverride(ctx, identity)
+	if err != nil {
+		return state, err
+	}
+	state.Override = override
+	return state, nil
+}
+
+// Reset deletes every counter of an identity, in Redis and in memory, and
+// returns how many Redis keys were deleted
+func (l *Limiter) Reset(ctx context.Context, identity string) (int, error) {
+	l.memory.resetIdentity(identity)
+	if !l.available.Load() {
+		return 0, ErrUnavailable
+	}
+
+	keys, err := l.counterKeys(ctx, identity)
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	// Delete one by one; the keys of different policies may live on different cluster nodes
+	deleted := 0
+	for _, key := range keys {
+		n, err := l.client.Del(ctx, key).Result()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(n)
+	}
+	return deleted, nil
+}
+
+// SetOverride stores an override for an identity until it expires
+func (l *Limiter) SetOverride(ctx context.Context, identity string, override Override) error {
+	if !l.available.Load() {
+		return ErrUnavailable
+	}
+
+	data, err := json.Marshal(override)
+	if err != nil {
+		return err
+	}
+	return l.client.Set(ctx, overridePrefix+identity, data, time.Until(override.ExpiresAt)).Err()
+}
+
+// ClearOverride removes the override of an identity and reports whether there was one
+func (l *Limiter) ClearOverride(ctx context.Context, identity string) (bool, error) {
+	if !l.available.Load() {
+		return false, ErrUnavailable
+	}
+
+	n, err := l.client.Del(ctx, overridePrefix+identity).Result()
+	return n > 0, err
+}
+
+func (l *Limiter) getOverride(ctx context.Context, identity string) (*Override, error) {
+	data, err := l.client.Get(ctx, overridePrefix+identity).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var override Override
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// applyOverrides looks up overrides for every part of a counter identity. An
+// exemption for any part exempts the request; otherwise the largest multiplier
+// is applied to the rate.
+func (l *Limiter) applyOverrides(ctx context.Context, identity string, rate Rate) (Rate, bool) {
+	// Pipelined GETs rather than MGET, as the keys may hash to different cluster slots
+	parts := strings.Split(identity, "|")
+	cmds := make([]*redis.StringCmd, len(parts))
+	_, err := l.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, part := range parts {
+			cmds[i] = pipe.Get(ctx, overridePrefix+part)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		l.logger.Debug("Failed to look up rate limit overrides", zap.Error(err))
+		return rate, false
+	}
+
+	multiplier := 1.0
+	for _, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+		var override Override
+		if err := json.Unmarshal(data, &override); err != nil {
+			continue
+		}
+		if override.Exempt {
+			return rate, true
+		}
+		multiplier = max(multiplier, override.Multiplier)
+	}
+
+	if multiplier > 1 {
+		rate.Limit = int(float64(rate.Limit) * multiplier)
+		rate.Burst = int(float64(rate.Burst) * multiplier)
+	}
+	return rate, false
+}
+
+// counterKeys scans Redis for the counters of an identity. In cluster mode
+// every master is scanned.
+func (l *Limiter) counterKeys(ctx context.Context, identity string) ([]string, error) {
+	pattern := "*rl:*" + escapeGlob(identity) + "*"
+
+	cluster, ok := l.client.(*redis.ClusterClient)
+	if !ok {
+		return scanCounterKeys(ctx, l.client, pattern, identity)
+	}
+
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanCounterKeys(ctx, node, pattern, identity)
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
+
+func scanCounterKeys(ctx context.Context, client redis.Cmdable, pattern, identity string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if isCounterKey(key) && containsIdentity(key, identity) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, iter.Err()
+}
+
+// isCounterKey reports whether a key holds a counter of any algorithm:
+// "rate:rl:..." for gcra, "rl:..." for fixed window and sliding log, and
+// "{rl:...}:sw:N" for sliding window
+func isCounterKey(key string) bool {
+	key = strings.TrimPrefix(key, gcraPrefix)
+	return strings.HasPrefix(key, "rl:") || strings.HasPrefix(key, "{rl:")
+}
+
+// containsIdentity reports whether a counter key was built from the identity,
+// so that "user:4" does not match the counters of "user:42"
+func containsIdentity(key, identity string) bool {
+	for start := 0; ; {
+		i := strings.Index(key[start:], identity)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(identity)
+		before := i > 0 && (key[i-1] == ':' || key[i-1] == '|')
+		after := end == len(key) || strings.ContainsRune(":|}", rune(key[end]))
+		if before && after {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+// policyFromKey extracts the policy name from "rl:<policy>:...", "rate:rl:<policy>:..."
+// or "{rl:<policy>:...}:sw:N"
+func policyFromKey(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(key, gcraPrefix), "{"), "rl:")
+	policy, _, _ := strings.Cut(key, ":")
+	return policy
+}
+
+// escapeGlob escapes the characters Redis MATCH patterns treat specially
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
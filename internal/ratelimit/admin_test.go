@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// scanClient answers SCAN from a fixed key set in a single page
+type scanClient struct {
+	redis.Cmdable
+	keys []string
+}
+
+func (s scanClient) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	var page []string
+	for _, key := range s.keys {
+		if ok, _ := path.Match(match, key); ok {
+			page = append(page, key)
+		}
+	}
+	return redis.NewScanCmdResult(page, 0, nil)
+}
+
+func TestScanCounterKeys(t *testing.T) {
+	client := scanClient{keys: []string{
+		"rate:rl:default:user:42",            // gcra, stored by redis_rate
+		"rate:rl:search:ip:10.0.0.1|user:42", // gcra, combined key
+		"rl:login:user:42:fw",                // fixed window
+		"rl:feed:user:42:log",                // sliding log
+		"{rl:browse:user:42}:sw:1700",        // sliding window
+		"rate:rl:default:user:420",           // another user
+		"rate:rl:apikey:key:k1",              // another identity kind
+		"rloverride:user:42",                 // override, not a counter
+		"session:user:42",                    // not a rate limit key
+	}}
+
+	tests := []struct {
+		identity string
+		want     []string
+	}{
+		{"user:42", []string{
+			"rate:rl:default:user:42",
+			"rate:rl:search:ip:10.0.0.1|user:42",
+			"rl:login:user:42:fw",
+			"rl:feed:user:42:log",
+			"{rl:browse:user:42}:sw:1700",
+		}},
+		{"ip:10.0.0.1", []string{"rate:rl:search:ip:10.0.0.1|user:42"}},
+		{"key:k1", []string{"rate:rl:apikey:key:k1"}},
+		{"user:4", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.identity, func(t *testing.T) {
+			pattern := "*rl:*" + escapeGlob(tt.identity) + "*"
+			got, err := scanCounterKeys(context.Background(), client, pattern, tt.identity)
+			if err != nil {
+				t.Fatalf("scanCounterKeys() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scanCounterKeys() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyFromKey(t *testing.T) {
+	tests := map[string]string{
+		"rate:rl:default:user:42":     "default",
+		"rate:rl:apikey:key:k1":       "apikey",
+		"rl:login:ip:10.0.0.1:fw":     "login",
+		"rl:feed:user:42:log":         "feed",
+		"{rl:browse:user:42}:sw:1700": "browse",
+	}
+	for key, want := range tests {
+		if got := policyFromKey(key); got != want {
+			t.Errorf("policyFromKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redis_rate/v9"
+	"github.com/google/uuid"
+)
+
+// fixedWindowScript counts a request costing ARGV[2] in the current window if
+// it fits the limit ARGV[3]. Returns whether it was allowed, the count, and
+// the milliseconds left in the window.
+var fixedWindowScript = redis.NewScript(`
+local cost = tonumber(ARGV[2])
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+local allowed = 0
+if count + cost <= tonumber(ARGV[3]) then
+	count = redis.call("INCRBY", KEYS[1], cost)
+	if count == cost then
+		redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	end
+	allowed = 1
+end
+local ttl = redis.call("PTTL", KEYS[1])
+return {allowed, count, ttl}
+`)
+
+// slidingLogScript records the request, as one entry per token of its cost, if
+// it fits the limit given the entries of the last window. Returns whether it
+// was allowed, the entry count, and the milliseconds until the oldest and
+// newest entries leave the window.
+var slidingLogScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local cost = tonumber(ARGV[5])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count + cost <= limit then
+	for i = 1, cost do
+		redis.call("ZADD", KEYS[1], now, ARGV[4] .. "-" .. i)
+	end
+	count = count + cost
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], window)
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+local retry, reset = 0, 0
+if oldest[2] then
+	retry = tonumber(oldest[2]) + window - now
+	reset = tonumber(newest[2]) + window - now
+end
+return {allowed, count, retry, reset}
+`)
+
+// slidingWindowScript estimates the requests in the last window from the
+// current and previous fixed window counters, weighting the previous one by
+// how much of it still overlaps, and counts the request's cost if it fits. Returns
+// whether it was allowed and the estimate, as a string to keep the fraction.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local estimate = previous * (window - elapsed) / window + current
+local allowed = 0
+if estimate + cost <= limit then
+	redis.call("INCRBY", KEYS[1], cost)
+	redis.call("PEXPIRE", KEYS[1], window * 2)
+	estimate = estimate + cost
+	allowed = 1
+end
+return {allowed, tostring(estimate), previous}
+`)
+
+// allowRedis counts a request costing cost tokens in Redis with the policy's algorithm
+func (l *Limiter) allowRedis(ctx context.Context, policy *Policy, key string, rate Rate, cost int) (Result, error) {
+	switch policy.Algorithm {
+	case AlgorithmFixedWindow:
+		return l.allowFixedWindow(ctx, key, rate, cost)
+	case AlgorithmSlidingLog:
+		return l.allowSlidingLog(ctx, key, rate, cost)
+	case AlgorithmSlidingWindow:
+		return l.allowSlidingWindow(ctx, key, rate, cost)
+	default:
+		return l.allowGCRA(ctx, key, rate, cost)
+	}
+}
+
+// allowGCRA allows Limit requests per Window on average, with up to Burst at once
+func (l *Limiter) allowGCRA(ctx context.Context, key string, rate Rate, cost int) (Result, error) {
+	burst := rate.Burst
+	if burst <= 0 {
+		burst = rate.Limit
+	}
+
+	res, err := l.redis.AllowN(ctx, key, redis_rate.Limit{
+		Rate:   rate.Limit,
+		Burst:  burst,
+		Period: rate.Window.Std(),
+	}, cost)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    res.Allowed > 0,
+		Limit:      rate.Limit,
+		Remaining:  res.Remaining,
+		ResetAfter: res.ResetAfter,
+		RetryAfter: res.RetryAfter,
+	}, nil
+}
+
+// allowFixedWindow allows Limit requests per window, starting with the first request
+func (l *Limiter) allowFixedWindow(ctx context.Context, key string, rate Rate, cost int) (Result, error) {
+	window := rate.Window.Std()
+
+	values, err := fixedWindowScript.Run(ctx, l.client, []string{key + ":fw"},
+		window.Milliseconds(), cost, rate.Limit).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	count, ttl := int(values[1]), time.Duration(values[2])*time.Millisecond
+	if ttl < 0 {
+		ttl = window
+	}
+
+	res := Result{
+		Allowed:    values[0] == 1,
+		Limit:      rate.Limit,
+		Remaining:  max(rate.Limit-count, 0),
+		ResetAfter: ttl,
+	}
+	if !res.Allowed {
+		res.RetryAfter = ttl
+	}
+	return res, nil
+}
+
+// allowSlidingLog allows Limit requests in any Window-long span by keeping a
+// timestamp per request
+func (l *Limiter) allowSlidingLog(ctx context.Context, key string, rate Rate, cost int) (Result, error) {
+	now := time.Now().UnixMilli()
+	window := rate.Window.Std().Milliseconds()
+
+	values, err := slidingLogScript.Run(ctx, l.client, []string{key + ":log"},
+		now, window, rate.Limit, strconv.FormatInt(now, 10)+"-"+uuid.NewString(), cost).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed, count := values[0] == 1, int(values[1])
+
+	res := Result{
+		Allowed:    allowed,
+		Limit:      rate.Limit,
+		Remaining:  max(rate.Limit-count, 0),
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration(values[2]) * time.Millisecond
+	}
+	return res, nil
+}
+
+// allowSlidingWindow approximates a sliding log with two fixed window counters
+func (l *Limiter) allowSlidingWindow(ctx context.Context, key string, rate Rate, cost int) (Result, error) {
+	window := rate.Window.Std()
+	now := time.Now()
+	index := now.UnixMilli() / window.Milliseconds()
+	elapsed := now.UnixMilli() - index*window.Milliseconds()
+	untilNext := window - time.Duration(elapsed)*time.Millisecond
+
+	// The hash tag keeps both counters in the same Redis Cluster slot
+	base := "{" + key + "}:sw:"
+	keys := []string{base + strconv.FormatInt(index, 10), base + strconv.FormatInt(index-1, 10)}
+
+	values, err := slidingWindowScript.Run(ctx, l.client, keys, rate.Limit, window.Milliseconds(), elapsed, cost).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed := values[0].(int64) == 1
+	estimate, _ := strconv.ParseFloat(values[1].(string), 64)
+	previous := float64(values[2].(int64))
+
+	res := Result{
+		Allowed:    allowed,
+		Limit:      rate.Limit,
+		Remaining:  max(rate.Limit-int(math.Ceil(estimate)), 0),
+		ResetAfter: untilNext,
+	}
+	if !allowed {
+		// Wait until enough of the previous window has slid out, or for the next window
+		res.RetryAfter = untilNext
+		if excess := estimate + float64(cost) - float64(rate.Limit); previous > 0 && excess <= previous*float64(untilNext)/float64(window) {
+			res.RetryAfter = time.Duration(excess / previous * float64(window))
+		}
+	}
+	return res, nil
+}
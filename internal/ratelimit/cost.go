@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// maxCost bounds every computed cost, so huge query values cannot overflow it
+const maxCost = 1 << 20
+
+// CostRule sets how many tokens requests to a set of routes consume from the
+// budget of the policy that covers them. The cost is Cost plus the costs
+// computed from the request's query parameters, kept between 1 and Max.
+type CostRule struct {
+	Routes   []string    `json:"routes"`
+	Cost     *int        `json:"cost"`      // Fixed cost, at least 1; defaults to 1
+	PerValue []ValueCost `json:"per_value"` // Costs growing with numeric parameters such as page_size
+	PerParam *ParamCost  `json:"per_param"` // Cost per parameter present, e.g. per search filter
+	Max      int         `json:"max"`       // Upper bound of the computed cost; zero means none
+}
+
+// ValueCost adds Weight for every started Per units of a numeric query parameter,
+// e.g. {"query": "page_size", "per": 20, "weight": 1} costs 3 for page_size=50
+type ValueCost struct {
+	Query  string `json:"query"`
+	Per    int    `json:"per"`
+	Weight int    `json:"weight"`
+}
+
+// ParamCost adds Weight for every query parameter present whose name matches
+// one of Params (glob patterns such as "filter_*")
+type ParamCost struct {
+	Params []string `json:"params"`
+	Weight int      `json:"weight"`
+}
+
+// Cost returns the tokens a request consumes; requests no rule covers cost 1
+func (p *Policies) Cost(r *http.Request) int {
+	for i := range p.costs {
+		if utils.MatchAnyRoute(p.costs[i].Routes, r.Method, r.URL.Path) {
+			return p.costs[i].cost(r)
+		}
+	}
+	return 1
+}
+
+func (rule *CostRule) cost(r *http.Request) int {
+	limit := maxCost
+	if rule.Max > 0 {
+		limit = min(rule.Max, maxCost)
+	}
+
+	query := r.URL.Query()
+	cost := 1
+	if rule.Cost != nil {
+		cost = *rule.Cost
+	}
+
+	for _, value := range rule.PerValue {
+		n, err := strconv.Atoi(query.Get(value.Query))
+		if err != nil || n <= 0 {
+			continue
+		}
+		units := n / value.Per
+		if n%value.Per != 0 {
+			units++
+		}
+		cost = addCost(cost, units, value.Weight, limit)
+	}
+
+	if rule.PerParam != nil {
+		for name := range query {
+			if matchAnyName(rule.PerParam.Params, name) {
+				cost = addCost(cost, 1, rule.PerParam.Weight, limit)
+			}
+		}
+	}
+
+	return max(1, min(cost, limit))
+}
+
+// addCost adds units*weight to cost, saturating at limit
+func addCost(cost, units, weight, limit int) int {
+	if cost >= limit || units > (limit-cost)/weight {
+		return limit
+	}
+	return cost + units*weight
+}
+
+func (rule *CostRule) validate() error {
+	if len(rule.Routes) == 0 {
+		return fmt.Errorf("at least one route is required")
+	}
+	if rule.Cost != nil && *rule.Cost < 1 {
+		return fmt.Errorf("cost must be at least 1")
+	}
+	if rule.Max < 0 {
+		return fmt.Errorf("max must not be negative")
+	}
+	for _, value := range rule.PerValue {
+		if value.Query == "" || value.Per <= 0 || value.Weight <= 0 {
+			return fmt.Errorf("per_value entries need a query, a positive per and a positive weight")
+		}
+	}
+	if rule.PerParam != nil && (len(rule.PerParam.Params) == 0 || rule.PerParam.Weight <= 0) {
+		return fmt.Errorf("per_param needs params and a positive weight")
+	}
+	return nil
+}
+
+func matchAnyName(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
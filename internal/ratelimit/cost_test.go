@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestCostRuleCost(t *testing.T) {
+	search := CostRule{
+		Routes:   []string{"GET /api/v1/users/search"},
+		PerValue: []ValueCost{{Query: "page_size", Per: 20, Weight: 1}},
+		PerParam: &ParamCost{Params: []string{"filter_*"}, Weight: 1},
+		Max:      10,
+	}
+	unbounded := search
+	unbounded.Max = 0
+	heavy := search
+	heavy.Cost = intPtr(5)
+
+	tests := []struct {
+		name  string
+		rule  CostRule
+		query string
+		want  int
+	}{
+		{"no parameters", search, "", 1},
+		{"fixed cost", heavy, "", 5},
+		{"started units", search, "page_size=50", 4},
+		{"filters", search, "filter_age=30&filter_city=x&sort=new", 3},
+		{"page size and filters", search, "page_size=50&filter_age=30&filter_city=x", 6},
+		{"capped at max", search, "page_size=1000", 10},
+		{"invalid value ignored", search, "page_size=abc", 1},
+		{"negative value ignored", search, "page_size=-40", 1},
+		{"huge value capped at max", search, "page_size=" + strconv.Itoa(math.MaxInt), 10},
+		{"huge value without max", unbounded, "page_size=" + strconv.Itoa(math.MaxInt), maxCost},
+		{"huge value with fixed cost", heavy, "page_size=" + strconv.Itoa(math.MaxInt-1), 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/users/search?"+tt.query, nil)
+			if got := tt.rule.cost(r); got != tt.want {
+				t.Errorf("cost() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPoliciesRejectsInvalidCosts(t *testing.T) {
+	defaultPolicy := Policy{Name: DefaultPolicyName, Rate: Rate{Limit: 10, Window: config.Duration(time.Minute)}}
+
+	tests := []struct {
+		name string
+		rule CostRule
+	}{
+		{"zero cost", CostRule{Routes: []string{"/x"}, Cost: intPtr(0)}},
+		{"negative cost", CostRule{Routes: []string{"/x"}, Cost: intPtr(-1)}},
+		{"negative max", CostRule{Routes: []string{"/x"}, Max: -1}},
+		{"no routes", CostRule{}},
+		{"zero weight", CostRule{Routes: []string{"/x"}, PerValue: []ValueCost{{Query: "n", Per: 1}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPolicies(Document{Costs: []CostRule{tt.rule}}, defaultPolicy); err == nil {
+				t.Error("NewPolicies() accepted an invalid cost rule")
+			}
+		})
+	}
+}
+
+func TestPoliciesCostDefaultsToOne(t *testing.T) {
+	policies, err := NewPolicies(Document{}, Policy{Name: DefaultPolicyName, Rate: Rate{Limit: 10, Window: config.Duration(time.Minute)}})
+	if err != nil {
+		t.Fatalf("NewPolicies() error = %v", err)
+	}
+	if got := policies.Cost(httptest.NewRequest("GET", "/api/v1/users/profile", nil)); got != 1 {
+		t.Errorf("Cost() = %d, want 1", got)
+	}
+}
+
+func TestPolicyCapacity(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		rate      Rate
+		want      int
+	}{
+		{"gcra burst", AlgorithmGCRA, Rate{Limit: 10, Burst: 30}, 30},
+		{"gcra without burst", AlgorithmGCRA, Rate{Limit: 10}, 10},
+		{"fixed window ignores burst", AlgorithmFixedWindow, Rate{Limit: 10, Burst: 30}, 10},
+		{"sliding log", AlgorithmSlidingLog, Rate{Limit: 5}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := Policy{Algorithm: tt.algorithm}
+			if got := policy.Capacity(tt.rate); got != tt.want {
+				t.Errorf("Capacity() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
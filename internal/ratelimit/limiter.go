@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redis_rate/v9"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/redisclient"
+)
+
+// Result is the outcome of a rate limit check
+type Result struct {
+	Allowed    bool
+	Limit      int           // Limit reported to the client
+	Remaining  int           // Requests left in the current window
+	ResetAfter time.Duration // Time until the budget is fully restored
+	RetryAfter time.Duration // Time until the next request would be allowed, when denied
+}
+
+// ErrUnavailable is returned for policies that do not fall back to memory while Redis is down
+var ErrUnavailable = errors.New("rate limit store unavailable")
+
+// Limiter checks requests against the rate limit policies. Counters live in
+// Redis; while Redis is unreachable, policies fall back to an in-process token
+// bucket or fail open or closed, and Redis is retried in the background.
+type Limiter struct {
+	logger    *zap.Logger
+	policies  *Policies
+	preAuth   *Policy // Nil when the pre-authentication limit is disabled
+	enabled   bool
+	client    redis.UniversalClient
+	redis     *redis_rate.Limiter
+	memory    *memoryLimiter
+	available atomic.Bool // Whether Redis answered the last command
+}
+
+// NewLimiter loads the policies and counts requests in the shared Redis
+// client. If Redis cannot be reached, requests are limited in memory until it can.
+func NewLimiter(cfg *config.Config, logger *zap.Logger, client redis.UniversalClient) *Limiter {
+	defaultPolicy := Policy{
+		Name: DefaultPolicyName,
+		Key:  KeyUser,
+		Rate: Rate{
+			Limit:  cfg.RateLimiting.Limit,
+			Window: config.Duration(cfg.RateLimiting.Window),
+			Burst:  cfg.RateLimiting.Burst,
+		},
+		Algorithm:   cfg.RateLimiting.Algorithm,
+		FailureMode: cfg.RateLimiting.FailureMode,
+	}
+
+	policies, err := LoadPolicies(cfg.RateLimiting.PoliciesFile, defaultPolicy)
+	if err != nil {
+		// Fall back to the default policy rather than running without limits
+		logger.Error("Failed to load rate limit policies, using the default policy only",
+			zap.Error(err), zap.String("file", cfg.RateLimiting.PoliciesFile))
+		policies = &Policies{defaultPolicy: defaultPolicy}
+	}
+
+	limiter := &Limiter{
+		logger:   logger,
+		policies: policies,
+		enabled:  cfg.RateLimiting.Enabled,
+		memory:   newMemoryLimiter(),
+	}
+	if cfg.RateLimiting.PreAuthEnabled {
+		limiter.preAuth = &Policy{
+			Name: PreAuthPolicyName,
+			Key:  KeyIP,
+			Rate: Rate{
+				Limit:  cfg.RateLimiting.PreAuthLimit,
+				Window: config.Duration(cfg.RateLimiting.PreAuthWindow),
+				Burst:  cfg.RateLimiting.PreAuthBurst,
+			},
+			Algorithm:   AlgorithmGCRA,
+			FailureMode: cfg.RateLimiting.FailureMode,
+		}
+	}
+	if !limiter.enabled {
+		return limiter
+	}
+
+	limiter.client = client
+	limiter.redis = redis_rate.NewLimiter(limiter.client)
+
+	// Try pinging Redis to check if the connection is successful
+	if err := limiter.client.Ping(context.Background()).Err(); err != nil {
+		// Log the failure; the watcher switches to Redis once it answers
+		logger.Error("Redis connection failed, rate limiting in memory until it is reachable",
+			zap.Error(err),
+			zap.String("redis", redisclient.Describe(cfg.Redis)),
+		)
+	} else {
+		limiter.available.Store(true)
+		logger.Info("Redis rate limiter initialized",
+			zap.Int("limit", cfg.RateLimiting.Limit),
+			zap.Duration("window", cfg.RateLimiting.Window),
+			zap.Int("policies", len(policies.policies)),
+		)
+	}
+
+	go limiter.watchRedis(cfg.RateLimiting.RedisCheckInterval)
+	return limiter
+}
+
+// Enabled reports whether requests are being limited
+func (l *Limiter) Enabled() bool {
+	return l != nil && l.enabled
+}
+
+// watchRedis pings Redis while it is unavailable and switches back to it once
+// it answers. It also drops idle in-memory buckets.
+func (l *Limiter) watchRedis(interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.memory.sweep(time.Now())
+		if l.available.Load() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := l.client.Ping(ctx).Err()
+		cancel()
+		if err != nil {
+			l.logger.Debug("Redis still unreachable", zap.Error(err))
+			continue
+		}
+
+		// Start from fresh buckets if Redis goes down again
+		l.memory.reset()
+		l.available.Store(true)
+		l.logger.Info("Redis reachable again, rate limiting switched back to Redis")
+	}
+}
+
+// markUnavailable stops sending commands to Redis until the watcher sees it again
+func (l *Limiter) markUnavailable(err error) {
+	if l.available.CompareAndSwap(true, false) {
+		l.logger.Error("Redis rate limiter unavailable, using the policy failure modes", zap.Error(err))
+	}
+}
+
+// Match returns the policy for a request
+func (l *Limiter) Match(method, requestPath string) *Policy {
+	return l.policies.Match(method, requestPath)
+}
+
+// PreAuth returns the per-IP policy applied before authentication, or nil if it is disabled
+func (l *Limiter) PreAuth() *Policy {
+	return l.preAuth
+}
+
+// Cost returns the tokens a request consumes from its policy's budget
+func (l *Limiter) Cost(r *http.Request) int {
+	return l.policies.Cost(r)
+}
+
+// Allow counts a request costing the given number of tokens against the
+// policy's budget for the given identity.
+// It returns ErrUnavailable when Redis is down and the policy fails open or closed.
+func (l *Limiter) Allow(ctx context.Context, policy *Policy, identity string, rate Rate, cost int) (Result, error) {
+	key := "rl:" + policy.Name + ":" + identity
+
+	if l.available.Load() {
+		var exempt bool
+		if rate, exempt = l.applyOverrides(ctx, identity, rate); exempt {
+			return Result{Allowed: true, Limit: rate.Limit, Remaining: rate.Limit}, nil
+		}
+
+		res, err := l.allowRedis(ctx, policy, key, rate, cost)
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			// The caller went away; Redis is not to blame
+			return Result{}, err
+		}
+		l.markUnavailable(err)
+	}
+
+	if policy.FailureMode == FailureModeMemory {
+		return l.memory.allow(key, rate, cost, time.Now()), nil
+	}
+	return Result{}, ErrUnavailable
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// memoryLimiter is an in-process token bucket limiter used while Redis is
+// unreachable. Counters are per gateway instance, so the effective limit of a
+// cluster is multiplied by the number of instances until Redis is back.
+type memoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket holds up to capacity tokens and refills at rate tokens per second
+type tokenBucket struct {
+	tokens   float64
+	capacity float64
+	rate     float64
+	updated  time.Time
+}
+
+func newMemoryLimiter() *memoryLimiter {
+	return &memoryLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes cost tokens from the bucket for key, refilling it first
+func (m *memoryLimiter) allow(key string, rate Rate, cost int, now time.Time) Result {
+	capacity := float64(rate.Burst)
+	if capacity <= 0 {
+		capacity = float64(rate.Limit)
+	}
+	perSecond := float64(rate.Limit) / rate.Window.Std().Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bucket, ok := m.buckets[key]
+	if !ok || bucket.capacity != capacity || bucket.rate != perSecond {
+		// New key, or the policy changed since the bucket was created
+		bucket = &tokenBucket{tokens: capacity, capacity: capacity, rate: perSecond, updated: now}
+		m.buckets[key] = bucket
+	}
+	bucket.refill(now)
+
+	res := Result{Limit: rate.Limit}
+	if bucket.tokens >= float64(cost) {
+		bucket.tokens -= float64(cost)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = bucket.timeUntil(float64(cost))
+	}
+	res.Remaining = int(math.Floor(bucket.tokens))
+	res.ResetAfter = bucket.timeUntil(bucket.capacity)
+	return res
+}
+
+// sweep drops buckets that have refilled completely; they are equivalent to new ones
+func (m *memoryLimiter) sweep(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, bucket := range m.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= bucket.capacity {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// reset drops every bucket
+func (m *memoryLimiter) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.buckets = make(map[string]*tokenBucket)
+}
+
+// resetIdentity drops the buckets built from an identity
+func (m *memoryLimiter) resetIdentity(identity string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.buckets {
+		if containsIdentity(key, identity) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+		b.updated = now
+	}
+}
+
+// timeUntil returns how long until the bucket holds the given number of tokens
+func (b *tokenBucket) timeUntil(tokens float64) time.Duration {
+	if b.tokens >= tokens {
+		return 0
+	}
+	return time.Duration((tokens - b.tokens) / b.rate * float64(time.Second))
+}
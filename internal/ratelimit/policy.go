@@ -0,0 +1,209 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// DefaultPolicyName is the policy applied to routes no other policy covers
+const DefaultPolicyName = "default"
+
+// PreAuthPolicyName is the per-IP policy applied before authentication
+const PreAuthPolicyName = "pre_auth"
+
+// Key parts a policy can build its counter key from
+const (
+	KeyIP     = "ip"      // Client address
+	KeyUser   = "user"    // Authenticated user ID, the client address for anonymous callers
+	KeyAPIKey = "api_key" // API key ID, the user or client address for other callers
+)
+
+// Algorithms a policy can count requests with
+const (
+	AlgorithmGCRA          = "gcra"           // Token bucket with Burst requests of headroom
+	AlgorithmFixedWindow   = "fixed_window"   // Limit requests per calendar window
+	AlgorithmSlidingLog    = "sliding_log"    // Limit requests in any Window-long span, exact
+	AlgorithmSlidingWindow = "sliding_window" // Limit requests in any Window-long span, estimated from two counters
+)
+
+// What a policy does while Redis is unreachable
+const (
+	FailureModeMemory = "memory" // Count in an in-process token bucket
+	FailureModeOpen   = "open"   // Allow every request
+	FailureModeClosed = "closed" // Reject every request
+)
+
+// Rate is a request budget
+type Rate struct {
+	Limit  int             `json:"limit"`  // Requests per window
+	Window config.Duration `json:"window"` // Window length, e.g. "1m"
+	Burst  int             `json:"burst"`  // Maximum burst size for gcra; defaults to Limit
+}
+
+// Policy is a named rate limit applied to a set of routes
+type Policy struct {
+	Name   string   `json:"name"`
+	Routes []string `json:"routes"` // Route patterns such as "POST /api/v1/auth/login" or "/api/v1/users/*"
+	Key    string   `json:"key"`    // Key parts joined by "+", e.g. "user" or "ip+user"; defaults to user
+	Rate
+	Algorithm     string `json:"algorithm"`     // gcra, fixed_window, sliding_log or sliding_window; defaults to RATE_LIMIT_ALGORITHM
+	Authenticated *Rate  `json:"authenticated"` // Budget for authenticated callers; defaults to Rate
+	FailureMode   string `json:"failure_mode"`  // memory, open or closed; defaults to RATE_LIMIT_FAILURE_MODE
+}
+
+// Document is the rate limit policy file
+type Document struct {
+	Policies []Policy   `json:"policies"`
+	Costs    []CostRule `json:"costs"` // Route costs; the first matching rule wins
+}
+
+// Policies matches requests to rate limit policies. The first policy whose
+// routes match wins; other requests use the default policy.
+type Policies struct {
+	policies      []Policy
+	defaultPolicy Policy
+	costs         []CostRule
+}
+
+// LoadPolicies reads the policy file, if any, and combines it with the default policy
+func LoadPolicies(file string, defaultPolicy Policy) (*Policies, error) {
+	if file == "" {
+		return NewPolicies(Document{}, defaultPolicy)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limit policy file: %w", err)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse rate limit policy file: %w", err)
+	}
+	return NewPolicies(doc, defaultPolicy)
+}
+
+// NewPolicies validates the document. A policy named "default" without routes
+// replaces the default policy. Policies without an algorithm or failure mode
+// inherit the default policy's.
+func NewPolicies(doc Document, defaultPolicy Policy) (*Policies, error) {
+	p := &Policies{defaultPolicy: defaultPolicy}
+
+	for i, policy := range doc.Policies {
+		if policy.Name == "" {
+			policy.Name = fmt.Sprintf("policy-%d", i+1)
+		}
+		if policy.Key == "" {
+			policy.Key = KeyUser
+		}
+		if policy.Algorithm == "" {
+			policy.Algorithm = defaultPolicy.Algorithm
+		}
+		if policy.FailureMode == "" {
+			policy.FailureMode = defaultPolicy.FailureMode
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("policy %s: %w", policy.Name, err)
+		}
+
+		if policy.Name == DefaultPolicyName && len(policy.Routes) == 0 {
+			p.defaultPolicy = policy
+			continue
+		}
+		if len(policy.Routes) == 0 {
+			return nil, fmt.Errorf("policy %s: at least one route is required", policy.Name)
+		}
+		p.policies = append(p.policies, policy)
+	}
+
+	for i, rule := range doc.Costs {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("cost rule %d: %w", i+1, err)
+		}
+		p.costs = append(p.costs, rule)
+	}
+
+	if p.defaultPolicy.Key == "" {
+		p.defaultPolicy.Key = KeyUser
+	}
+	if p.defaultPolicy.Algorithm == "" {
+		p.defaultPolicy.Algorithm = AlgorithmGCRA
+	}
+	if p.defaultPolicy.FailureMode == "" {
+		p.defaultPolicy.FailureMode = FailureModeMemory
+	}
+	if err := p.defaultPolicy.validate(); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", p.defaultPolicy.Name, err)
+	}
+	return p, nil
+}
+
+// Match returns the policy for a request
+func (p *Policies) Match(method, requestPath string) *Policy {
+	for i := range p.policies {
+		if utils.MatchAnyRoute(p.policies[i].Routes, method, requestPath) {
+			return &p.policies[i]
+		}
+	}
+	return &p.defaultPolicy
+}
+
+// RateFor returns the budget for anonymous or authenticated callers
+func (p *Policy) RateFor(authenticated bool) Rate {
+	if authenticated && p.Authenticated != nil {
+		return *p.Authenticated
+	}
+	return p.Rate
+}
+
+// Capacity returns the largest cost a single request can ever fit in rate:
+// the burst for gcra, which defaults to the limit, and the limit otherwise
+func (p *Policy) Capacity(rate Rate) int {
+	if p.Algorithm == AlgorithmGCRA && rate.Burst > 0 {
+		return rate.Burst
+	}
+	return rate.Limit
+}
+
+// KeyParts returns the parts the counter key is built from
+func (p *Policy) KeyParts() []string {
+	return strings.Split(p.Key, "+")
+}
+
+func (p *Policy) validate() error {
+	for _, part := range p.KeyParts() {
+		switch part {
+		case KeyIP, KeyUser, KeyAPIKey:
+		default:
+			return fmt.Errorf("invalid key part %q, expected ip, user or api_key", part)
+		}
+	}
+	switch p.Algorithm {
+	case AlgorithmGCRA, AlgorithmFixedWindow, AlgorithmSlidingLog, AlgorithmSlidingWindow:
+	default:
+		return fmt.Errorf("invalid algorithm %q, expected gcra, fixed_window, sliding_log or sliding_window", p.Algorithm)
+	}
+	switch p.FailureMode {
+	case FailureModeMemory, FailureModeOpen, FailureModeClosed:
+	default:
+		return fmt.Errorf("invalid failure mode %q, expected memory, open or closed", p.FailureMode)
+	}
+	rates := []Rate{p.Rate}
+	if p.Authenticated != nil {
+		rates = append(rates, *p.Authenticated)
+	}
+	for _, rate := range rates {
+		if rate.Limit <= 0 || rate.Window.Std() <= 0 {
+			return fmt.Errorf("limit and window must be positive")
+		}
+		if rate.Burst < 0 {
+			return fmt.Errorf("burst must not be negative")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package roles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hierarchy resolves the roles a role inherits. It is built from entries of
+// the form "parent>child", meaning parent has every permission of child, e.g.
+// "superadmin>admin", "admin>moderator", "moderator>user", "premium_user>user".
+type Hierarchy struct {
+	inherits map[string][]string // Every role reachable from the key, in breadth-first order
+}
+
+// Parse builds a hierarchy from "parent>child" entries and rejects cycles
+func Parse(entries []string) (*Hierarchy, error) {
+	direct := make(map[string][]string)
+	for _, entry := range entries {
+		parts := strings.Split(entry, ">")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid role hierarchy entry %q, expected parent>child", entry)
+		}
+		parent, child := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		direct[parent] = append(direct[parent], child)
+	}
+
+	h := &Hierarchy{inherits: make(map[string][]string, len(direct))}
+	for role := range direct {
+		var inherited []string
+		seen := map[string]bool{role: true}
+		queue := append([]string(nil), direct[role]...)
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			if next == role {
+				return nil, fmt.Errorf("role hierarchy has a cycle through %q", role)
+			}
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			inherited = append(inherited, next)
+			queue = append(queue, direct[next]...)
+		}
+		h.inherits[role] = inherited
+	}
+	return h, nil
+}
+
+// Effective returns the given roles followed by every role they inherit, without duplicates
+func (h *Hierarchy) Effective(assigned []string) []string {
+	effective := make([]string, 0, len(assigned))
+	seen := make(map[string]bool, len(assigned))
+	add := func(role string) {
+		if !seen[role] {
+			seen[role] = true
+			effective = append(effective, role)
+		}
+	}
+
+	for _, role := range assigned {
+		add(role)
+	}
+	if h == nil {
+		return effective
+	}
+	for _, role := range assigned {
+		for _, inherited := range h.inherits[role] {
+			add(inherited)
+		}
+	}
+	return effective
+}
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/audit"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/middleware"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// impersonationRequest is the body of the impersonation endpoint
+type impersonationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// createImpersonationHandler issues a short-lived token that lets an admin act
+// as the user in the path. The token's act claim keeps the real admin's identity.
+func createImpersonationHandler(cfg *config.Config, logger *zap.Logger, auditLogger *audit.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get(constants.ContextKeyUser)
+		admin, ok := value.(*middleware.UserClaims)
+		if !ok {
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "User claims not found", nil))
+			return
+		}
+
+		targetID := c.Param("id")
+		if targetID == admin.UserID {
+			c.Error(apiErrors.BadRequestError("You cannot impersonate yourself", nil))
+			return
+		}
+
+		var body impersonationRequest
+		if err := c.ShouldBindJSON(&body); err != nil || strings.TrimSpace(body.Reason) == "" {
+			c.Error(apiErrors.ValidationError("A reason is required to impersonate a user",
+				map[string]string{"reason": "required"}))
+			return
+		}
+
+		now := time.Now()
+		expiresAt := now.Add(cfg.Impersonation.TTL)
+		claims := middleware.UserClaims{
+			UserID: targetID,
+			Roles:  cfg.Impersonation.Roles,
+			Act:    &middleware.Actor{Sub: admin.UserID, Email: admin.Email},
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        uuid.New().String(),
+				Issuer:    cfg.JWT.Issuer,
+				Subject:   targetID,
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWT.Secret))
+		if err != nil {
+			c.Error(apiErrors.InternalError("Failed to issue impersonation token", err))
+			return
+		}
+
+		auditLogger.Record(audit.Event{
+			Action:    constants.AuditImpersonationStart,
+			ActorID:   admin.UserID,
+			SubjectID: targetID,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    http.StatusOK,
+			ClientIP:  c.ClientIP(),
+			RequestID: c.GetHeader(constants.HeaderRequestID),
+			Details: map[string]interface{}{
+				"reason":     body.Reason,
+				"token_id":   claims.ID,
+				"expires_at": expiresAt.UTC().Format(time.RFC3339),
+			},
+		})
+		logger.Info("Impersonation token issued",
+			zap.String("admin_id", admin.UserID),
+			zap.String("user_id", targetID))
+
+		utils.RespondWithSuccess(c, "Impersonation token issued", gin.H{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int(cfg.Impersonation.TTL.Seconds()),
+			"user_id":      targetID,
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/identity"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/middleware"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/oidc"
+)
+
+// oidcCookiePath scopes the login state cookie to the OIDC routes
+const oidcCookiePath = "/api/v1/auth/oidc"
+
+// accountLinkRequest is sent to auth-service to link or create the account for a
+// verified external identity
+type accountLinkRequest struct {
+	Provider      string `json:"provider"`
+	Issuer        string `json:"issuer"`
+	Subject       string `json:"subject"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name,omitempty"`
+}
+
+// registerOIDCRoutes sets up the social login routes for every configured provider
+func registerOIDCRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger) {
+	if !cfg.OIDC.Enabled {
+		return
+	}
+
+	providerConfigs, err := oidc.LoadProviders(cfg.OIDC.ProvidersFile)
+	if err != nil {
+		logger.Error("OIDC login disabled", zap.Error(err))
+		return
+	}
+
+	httpClient := &http.Client{Timeout: cfg.OIDC.HTTPTimeout}
+	signer := identity.NewSigner(cfg)
+	providers := make(map[string]*oidc.Provider, len(providerConfigs))
+	for _, providerConfig := range providerConfigs {
+		providers[providerConfig.Name] = oidc.NewProvider(providerConfig, httpClient)
+		logger.Info("Configured OIDC provider",
+			zap.String("provider", providerConfig.Name),
+			zap.String("issuer", providerConfig.Issuer))
+	}
+
+	router.GET("/oidc/:provider/login", createOIDCLoginHandler(providers, cfg, logger))
+
+	// The callback returns auth-service's login response, so cookie sessions apply to it too.
+	// Providers using response_mode=form_post (Apple) call back with POST.
+	callback := createOIDCCallbackHandler(providers, httpClient, signer, cfg, logger)
+	router.GET("/oidc/:provider/callback", middleware.SessionCookieMiddleware(cfg, logger), callback)
+	router.POST("/oidc/:provider/callback", middleware.SessionCookieMiddleware(cfg, logger), callback)
+}
+
+// createOIDCLoginHandler starts the authorization-code flow with PKCE and
+// redirects the browser to the provider
+func createOIDCLoginHandler(providers map[string]*oidc.Provider, cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			c.Error(apiErrors.NotFoundError("Unknown login provider"))
+			return
+		}
+
+		state, err := oidc.RandomString(24)
+		if err != nil {
+			c.Error(apiErrors.InternalError("Failed to start login", err))
+			return
+		}
+		nonce, err := oidc.RandomString(24)
+		if err != nil {
+			c.Error(apiErrors.InternalError("Failed to start login", err))
+			return
+		}
+		verifier, err := oidc.NewCodeVerifier()
+		if err != nil {
+			c.Error(apiErrors.InternalError("Failed to start login", err))
+			return
+		}
+
+		authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, oidc.CodeChallengeS256(verifier))
+		if err != nil {
+			logger.Error("OIDC provider unavailable", zap.String("provider", provider.Name()), zap.Error(err))
+			c.Error(apiErrors.ServiceUnavailableError("Login provider unavailable", err))
+			return
+		}
+
+		// Keep state, nonce and verifier in a signed cookie until the callback
+		encoded, err := oidc.EncodeState(cfg.OIDC.StateSecret, oidc.FlowState{
+			Provider:  provider.Name(),
+			State:     state,
+			Nonce:     nonce,
+			Verifier:  verifier,
+			ExpiresAt: time.Now().Add(cfg.OIDC.StateTTL).Unix(),
+		})
+		if err != nil {
+			c.Error(apiErrors.InternalError("Failed to start login", err))
+			return
+		}
+
+		c.SetSameSite(middleware.SameSiteMode(cfg.OIDC.CookieSameSite))
+		c.SetCookie(cfg.OIDC.StateCookieName, encoded, int(cfg.OIDC.StateTTL.Seconds()),
+			oidcCookiePath, cfg.Session.CookieDomain, cfg.Session.CookieSecure, true)
+
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// createOIDCCallbackHandler completes the flow: it checks the state, redeems the
+// code, validates the ID token and asks auth-service for a first-party JWT. The
+// link request carries an identity token, so auth-service only issues tokens
+// for identities the gateway verified.
+func createOIDCCallbackHandler(providers map[string]*oidc.Provider, httpClient *http.Client, signer *identity.Signer, cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			c.Error(apiErrors.NotFoundError("Unknown login provider"))
+			return
+		}
+
+		// The state cookie is single-use
+		stateCookie, _ := c.Cookie(cfg.OIDC.StateCookieName)
+		c.SetSameSite(middleware.SameSiteMode(cfg.OIDC.CookieSameSite))
+		c.SetCookie(cfg.OIDC.StateCookieName, "", -1,
+			oidcCookiePath, cfg.Session.CookieDomain, cfg.Session.CookieSecure, true)
+
+		if providerError := c.Request.FormValue("error"); providerError != "" {
+			logger.Debug("OIDC provider returned an error",
+				zap.String("provider", provider.Name()),
+				zap.String("error", providerError))
+			c.Error(apiErrors.NewWithDetails(apiErrors.ErrorTypeUnauthorized, "Login was not completed",
+				map[string]string{"error": providerError}, nil))
+			return
+		}
+
+		flow, err := oidc.DecodeState(cfg.OIDC.StateSecret, stateCookie)
+		if err != nil || flow.Provider != provider.Name() || flow.State != c.Request.FormValue("state") {
+			logger.Debug("OIDC state mismatch", zap.String("provider", provider.Name()), zap.Error(err))
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "Invalid login state", err))
+			return
+		}
+
+		code := c.Request.FormValue("code")
+		if code == "" {
+			c.Error(apiErrors.BadRequestError("Missing authorization code", nil))
+			return
+		}
+
+		token, err := provider.Exchange(c.Request.Context(), code, flow.Verifier)
+		if err != nil {
+			logger.Warn("OIDC code exchange failed", zap.String("provider", provider.Name()), zap.Error(err))
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "Login failed", err))
+			return
+		}
+
+		external, err := provider.VerifyIDToken(c.Request.Context(), token.IDToken, flow.Nonce)
+		if err != nil {
+			logger.Warn("OIDC ID token rejected", zap.String("provider", provider.Name()), zap.Error(err))
+			c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "Login failed", err))
+			return
+		}
+
+		link := accountLinkRequest{
+			Provider:      provider.Name(),
+			Issuer:        provider.Issuer(),
+			Subject:       external.Subject,
+			Email:         external.Email,
+			EmailVerified: bool(external.EmailVerified),
+			Name:          external.Name,
+		}
+		body, err := json.Marshal(link)
+		if err != nil {
+			c.Error(apiErrors.InternalError("Failed to link account", err))
+			return
+		}
+
+		// The identity token repeats the verified identity, so auth-service can
+		// check the body against it
+		identityToken, err := signer.Sign(identity.Claims{
+			AuthMethod: constants.AuthMethodOIDC,
+			Verified: map[string]interface{}{
+				"provider":       link.Provider,
+				"iss":            link.Issuer,
+				"sub":            link.Subject,
+				"email":          link.Email,
+				"email_verified": link.EmailVerified,
+			},
+			RequestID: c.GetHeader(constants.HeaderRequestID),
+			ClientIP:  c.ClientIP(),
+		})
+		if err != nil {
+			c.Error(apiErrors.InternalError("Failed to link account", err))
+			return
+		}
+
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost,
+			cfg.Services.AuthServiceURL+cfg.OIDC.LinkPath, bytes.NewReader(body))
+		if err != nil {
+			c.Error(apiErrors.InternalError("Failed to link account", err))
+			return
+		}
+		req.Header.Set(constants.HeaderContentType, constants.HeaderApplicationJSON)
+		req.Header.Set(constants.HeaderRequestID, c.GetHeader(constants.HeaderRequestID))
+		req.Header.Set(cfg.Identity.Header, identityToken)
+
+		release, ok := middleware.AcquireUpstream(c)
+		if !ok {
+			return
+		}
+		defer release()
+		releaseSlot, ok := middleware.AcquireConcurrencySlot(c)
+		if !ok {
+			return
+		}
+		defer releaseSlot()
+
+		start := time.Now()
+		resp, err := httpClient.Do(req)
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		middleware.RecordUpstreamResult(c, time.Since(start), status, err)
+		if err != nil {
+			logger.Error("Account link request failed", zap.Error(err))
+			c.Error(apiErrors.ServiceUnavailableError(constants.ErrServiceUnavailable, err))
+			return
+		}
+		defer resp.Body.Close()
+
+		logger.Info("OIDC login completed",
+			zap.String("provider", provider.Name()),
+			zap.String("subject", external.Subject),
+			zap.Int("linkStatus", resp.StatusCode))
+
+		// Return auth-service's response, which carries the first-party tokens
+		c.Status(resp.StatusCode)
+		c.Header(constants.HeaderContentType, resp.Header.Get(constants.HeaderContentType))
+		io.Copy(c.Writer, resp.Body)
+	}
+}
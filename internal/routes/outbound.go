@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/outbound"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// registerOutboundAdminRoutes exposes the queue depth and rejection counts of
+// the outbound limits for monitoring
+func registerOutboundAdminRoutes(router *gin.RouterGroup, services *sharedServices) {
+	router.GET("/upstream-limits", createOutboundStatsHandler(services.outbound))
+}
+
+// createOutboundStatsHandler returns the stats of every limited upstream
+func createOutboundStatsHandler(limiter *outbound.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utils.RespondWithSuccess(c, "Upstream limits retrieved", gin.H{"upstreams": limiter.Stats()})
+	}
+}
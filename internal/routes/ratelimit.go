@@ -0,0 +1,217 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/audit"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/middleware"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/ratelimit"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/utils"
+)
+
+// rateLimitOverrideRequest is the body of the override endpoint
+type rateLimitOverrideRequest struct {
+	Exempt     bool            `json:"exempt"`
+	Multiplier float64         `json:"multiplier"` // Raises limit and burst when not exempt
+	TTL        config.Duration `json:"ttl"`
+	Reason     string          `json:"reason"`
+}
+
+// registerRateLimitAdminRoutes lets support inspect and clear the limiter
+// state of an IP, user or API key, e.g. GET /rate-limits/user/42
+func registerRateLimitAdminRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger, services *sharedServices) {
+	router.GET("/rate-limits/:kind/:id", createRateLimitStateHandler(cfg, services.rateLimiter))
+	router.DELETE("/rate-limits/:kind/:id", createRateLimitResetHandler(cfg, logger, services))
+	router.PUT("/rate-limits/:kind/:id/override", createRateLimitOverrideHandler(cfg, logger, services))
+	router.DELETE("/rate-limits/:kind/:id/override", createRateLimitOverrideRevokeHandler(cfg, logger, services))
+}
+
+// createRateLimitStateHandler returns the counters and override of an identity
+func createRateLimitStateHandler(cfg *config.Config, limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := rateLimitIdentityParam(c, cfg)
+		if !ok {
+			return
+		}
+
+		state, err := limiter.Inspect(c.Request.Context(), identity)
+		if err != nil {
+			c.Error(apiErrors.ServiceUnavailableError("Rate limit store unavailable", err))
+			return
+		}
+		utils.RespondWithSuccess(c, "Rate limit state retrieved", state)
+	}
+}
+
+// createRateLimitResetHandler deletes the counters of an identity
+func createRateLimitResetHandler(cfg *config.Config, logger *zap.Logger, services *sharedServices) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin, ok := adminClaims(c)
+		if !ok {
+			return
+		}
+		identity, ok := rateLimitIdentityParam(c, cfg)
+		if !ok {
+			return
+		}
+
+		deleted, err := services.rateLimiter.Reset(c.Request.Context(), identity)
+		if err != nil {
+			c.Error(apiErrors.ServiceUnavailableError("Rate limit store unavailable", err))
+			return
+		}
+
+		recordRateLimitChange(c, services.audit, constants.AuditRateLimitReset, admin, identity,
+			map[string]interface{}{"deleted_counters": deleted})
+		logger.Info("Rate limit counters reset",
+			zap.String("admin_id", admin.UserID),
+			zap.String("identity", identity),
+			zap.Int("deleted", deleted))
+
+		utils.RespondWithSuccess(c, "Rate limit counters reset", gin.H{
+			"identity":         identity,
+			"deleted_counters": deleted,
+		})
+	}
+}
+
+// createRateLimitOverrideHandler exempts an identity from rate limiting, or
+// raises its limits, for a limited time
+func createRateLimitOverrideHandler(cfg *config.Config, logger *zap.Logger, services *sharedServices) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin, ok := adminClaims(c)
+		if !ok {
+			return
+		}
+		identity, ok := rateLimitIdentityParam(c, cfg)
+		if !ok {
+			return
+		}
+
+		var body rateLimitOverrideRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Error(apiErrors.BadRequestError("Invalid override", err))
+			return
+		}
+		problems := map[string]string{}
+		if strings.TrimSpace(body.Reason) == "" {
+			problems["reason"] = "required"
+		}
+		if !body.Exempt && body.Multiplier <= 1 {
+			problems["multiplier"] = "must be greater than 1 unless exempt is true"
+		}
+		if ttl := body.TTL.Std(); ttl <= 0 || ttl > cfg.RateLimiting.OverrideMaxTTL {
+			problems["ttl"] = "must be positive and at most " + cfg.RateLimiting.OverrideMaxTTL.String()
+		}
+		if len(problems) > 0 {
+			c.Error(apiErrors.ValidationError("Invalid override", problems))
+			return
+		}
+
+		override := ratelimit.Override{
+			Exempt:     body.Exempt,
+			Multiplier: body.Multiplier,
+			Reason:     body.Reason,
+			GrantedBy:  admin.UserID,
+			ExpiresAt:  time.Now().Add(body.TTL.Std()).UTC(),
+		}
+		if override.Exempt {
+			override.Multiplier = 0
+		}
+		if err := services.rateLimiter.SetOverride(c.Request.Context(), identity, override); err != nil {
+			c.Error(apiErrors.ServiceUnavailableError("Rate limit store unavailable", err))
+			return
+		}
+
+		recordRateLimitChange(c, services.audit, constants.AuditRateLimitOverrideGrant, admin, identity,
+			map[string]interface{}{
+				"exempt":     override.Exempt,
+				"multiplier": override.Multiplier,
+				"reason":     override.Reason,
+				"expires_at": override.ExpiresAt.Format(time.RFC3339),
+			})
+		logger.Info("Rate limit override granted",
+			zap.String("admin_id", admin.UserID),
+			zap.String("identity", identity),
+			zap.Time("expires_at", override.ExpiresAt))
+
+		utils.RespondWithSuccess(c, "Rate limit override granted", gin.H{
+			"identity": identity,
+			"override": override,
+		})
+	}
+}
+
+// createRateLimitOverrideRevokeHandler removes the override of an identity
+func createRateLimitOverrideRevokeHandler(cfg *config.Config, logger *zap.Logger, services *sharedServices) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin, ok := adminClaims(c)
+		if !ok {
+			return
+		}
+		identity, ok := rateLimitIdentityParam(c, cfg)
+		if !ok {
+			return
+		}
+
+		removed, err := services.rateLimiter.ClearOverride(c.Request.Context(), identity)
+		if err != nil {
+			c.Error(apiErrors.ServiceUnavailableError("Rate limit store unavailable", err))
+			return
+		}
+		if !removed {
+			c.Error(apiErrors.NotFoundError("No override for this identity"))
+			return
+		}
+
+		recordRateLimitChange(c, services.audit, constants.AuditRateLimitOverrideRevoke, admin, identity, nil)
+		logger.Info("Rate limit override revoked",
+			zap.String("admin_id", admin.UserID),
+			zap.String("identity", identity))
+
+		utils.RespondWithSuccess(c, "Rate limit override revoked", gin.H{"identity": identity})
+	}
+}
+
+// rateLimitIdentityParam reads the identity from the :kind and :id path parameters
+func rateLimitIdentityParam(c *gin.Context, cfg *config.Config) (string, bool) {
+	identity, err := ratelimit.ParseIdentity(c.Param("kind"), c.Param("id"), cfg.ClientIP.IPv6PrefixLength)
+	if err != nil {
+		c.Error(apiErrors.BadRequestError(err.Error(), err))
+		return "", false
+	}
+	return identity, true
+}
+
+// adminClaims returns the claims of the admin making the request
+func adminClaims(c *gin.Context) (*middleware.UserClaims, bool) {
+	value, _ := c.Get(constants.ContextKeyUser)
+	admin, ok := value.(*middleware.UserClaims)
+	if !ok {
+		c.Error(apiErrors.New(apiErrors.ErrorTypeUnauthorized, "User claims not found", nil))
+	}
+	return admin, ok
+}
+
+// recordRateLimitChange writes an audit event for a change to the limiter state
+func recordRateLimitChange(c *gin.Context, auditLogger *audit.Logger, action string, admin *middleware.UserClaims, identity string, details map[string]interface{}) {
+	auditLogger.Record(audit.Event{
+		Action:    action,
+		ActorID:   admin.UserID,
+		SubjectID: identity,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    http.StatusOK,
+		ClientIP:  c.ClientIP(),
+		RequestID: c.GetHeader(constants.HeaderRequestID),
+		Details:   details,
+	})
+}
@@ -2,16 +2,27 @@ package routes
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/audit"
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/config"
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/constants"
+	apiErrors "github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/errors"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/loadshed"
 	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/middleware"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/outbound"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/ratelimit"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/redisclient"
+	"github.com/mohamedfawas/api-gateway-qubool-kallyaanam/internal/roles"
 )
 
 const requestTimeout = 10 * time.Second // Set a timeout for HTTP requests to 10 seconds
@@ -24,22 +35,69 @@ type RouteGroup struct {
 	Logger *zap.Logger
 }
 
-// RegisterRoutes sets up all API routes for the gateway
-func RegisterRoutes(router *gin.Engine, cfg *config.Config, logger *zap.Logger) {
+// sharedServices holds the state every route group uses
+type sharedServices struct {
+	redis       redis.UniversalClient
+	audit       *audit.Logger
+	rateLimiter *ratelimit.Limiter
+	shedder     *loadshed.Shedder
+	outbound    *outbound.Limiter
+
+	// Token checks share one introspection cache and role hierarchy
+	introspector *middleware.TokenIntrospector
+	hierarchy    *roles.Hierarchy
+}
+
+// RegisterRoutes sets up all API routes for the gateway. Every Redis-backed
+// feature uses redisClient.
+func RegisterRoutes(router *gin.Engine, cfg *config.Config, logger *zap.Logger, redisClient redis.UniversalClient) {
 	// Create API version group. This groups all routes under the /api/v1 prefix.
 	apiV1 := router.Group("/api/v1")
 
+	// Audit trail, rate limit counters, concurrency and outbound limits, and token checks shared by all route groups
+	services := &sharedServices{
+		redis:       redisClient,
+		audit:       audit.NewLogger(cfg, logger),
+		rateLimiter: ratelimit.NewLimiter(cfg, logger, redisClient),
+		shedder:     loadshed.NewShedder(cfg.Concurrency),
+		outbound:    outbound.NewLimiter(cfg.Outbound),
+
+		introspector: middleware.NewTokenIntrospector(cfg, logger),
+		hierarchy:    middleware.NewRoleHierarchy(cfg, logger),
+	}
+	preAuthLimit := middleware.PreAuthRateLimiterMiddleware(cfg, logger, services.rateLimiter)
+
 	// Register a health-check endpoint that can be used to check if the API gateway is running.
-	router.GET("/health", createHealthHandler(cfg, logger))
+	router.GET("/health", preAuthLimit, createHealthHandler(cfg, logger))
+
+	// Register a readiness endpoint that reports whether the gateway's own dependencies are reachable.
+	router.GET("/ready", preAuthLimit, createReadinessHandler(cfg, logger, redisClient))
+
+	for _, stats := range services.outbound.Stats() {
+		logger.Info("Outbound limits initialized",
+			zap.String("upstream", stats.Upstream),
+			zap.Float64("rate", stats.Rate),
+			zap.Int("maxConcurrent", stats.MaxConcurrent),
+			zap.Int("queueSize", stats.QueueSize))
+	}
 
 	// Register service routes
-	registerAuthRoutes(apiV1.Group("/auth"), cfg, logger)
-	registerUserRoutes(apiV1.Group("/users"), cfg, logger)
-	registerAdminRoutes(apiV1.Group("/admin"), cfg, logger)
+	registerAuthRoutes(apiV1.Group("/auth"), cfg, logger, services)
+	registerUserRoutes(apiV1.Group("/users"), cfg, logger, services)
+	registerAdminRoutes(apiV1.Group("/admin"), cfg, logger, services)
 }
 
-// newPublicGroup creates a route group without authentication
-func newPublicGroup(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger) *RouteGroup {
+// newPublicGroup creates a route group without authentication for an upstream.
+// Its routes are rate limited and load shed with every caller treated as anonymous.
+func newPublicGroup(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger, services *sharedServices, upstream string) *RouteGroup {
+	// A child group keeps these middlewares off routes added to the parent by other groups
+	router = router.Group("")
+	router.Use(middleware.RateLimiterMiddleware(cfg, logger, services.rateLimiter))
+	router.Use(middleware.LoadSheddingMiddleware(cfg, logger, services.shedder, upstream))
+
+	// Hold forwarded traffic to the upstream's capacity; the proxy handler takes the gate
+	router.Use(middleware.OutboundLimitMiddleware(cfg, logger, services.outbound, upstream))
+
 	return &RouteGroup{
 		Router: router,
 		Config: cfg,
@@ -47,16 +105,41 @@ func newPublicGroup(router *gin.RouterGroup, cfg *config.Config, logger *zap.Log
 	}
 }
 
-// newProtectedGroup creates a route group with authentication
-func newProtectedGroup(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger, roles []string) *RouteGroup {
-	// Apply JWT middleware to this group
-	router.Use(middleware.JWTAuthMiddleware(cfg, logger))
+// newProtectedGroup creates a route group with authentication for an upstream.
+// The accepted authentication methods default to JWT only.
+func newProtectedGroup(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger, services *sharedServices, upstream string, roles []string, authMethods ...string) *RouteGroup {
+	// A child group keeps these middlewares off routes added to the parent by other groups
+	router = router.Group("")
+
+	// Throttle each address before authentication, which costs token checks and introspection calls
+	router.Use(middleware.PreAuthRateLimiterMiddleware(cfg, logger, services.rateLimiter))
+
+	// Apply authentication middleware to this group
+	router.Use(middleware.AuthMiddleware(cfg, logger, services.redis, services.introspector, services.hierarchy, authMethods...))
+
+	// Rate limit after authentication, so policies can count per user or API key
+	router.Use(middleware.RateLimiterMiddleware(cfg, logger, services.rateLimiter))
+
+	// Shed load by priority, which depends on the caller being authenticated
+	router.Use(middleware.LoadSheddingMiddleware(cfg, logger, services.shedder, upstream))
+
+	// Restrict and audit requests made by admins impersonating a user
+	router.Use(middleware.ImpersonationMiddleware(cfg, logger, services.audit))
 
 	// If roles are specified, apply role middleware
 	if len(roles) > 0 {
 		router.Use(middleware.RoleAuthMiddleware(roles, logger))
 	}
 
+	// Apply the finer-grained rules of the policy file
+	router.Use(middleware.PolicyMiddleware(cfg, logger))
+
+	// Forward the authenticated identity to the upstream service
+	router.Use(middleware.IdentityPropagationMiddleware(cfg, logger))
+
+	// Hold forwarded traffic to the upstream's capacity; the proxy handler takes the gate
+	router.Use(middleware.OutboundLimitMiddleware(cfg, logger, services.outbound, upstream))
+
 	return &RouteGroup{
 		Router: router,
 		Config: cfg,
@@ -65,51 +148,141 @@ func newProtectedGroup(router *gin.RouterGroup, cfg *config.Config, logger *zap.
 }
 
 // registerAuthRoutes sets up all authentication-related routes
-func registerAuthRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger) {
-	authGroup := newPublicGroup(router, cfg, logger)
+func registerAuthRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger, services *sharedServices) {
+	authGroup := newPublicGroup(router, cfg, logger, services, constants.UpstreamAuth)
 
 	// Health check endpoint
 	authGroup.Router.GET("/health", createProxyHandler(cfg.Services.AuthServiceURL+"/health", http.MethodGet, logger))
 
 	// Auth endpoints
-	authGroup.Router.POST("/register", createProxyHandler(cfg.Services.AuthServiceURL+"/auth/register", http.MethodPost, logger))
+	authGroup.Router.POST("/register",
+		middleware.ChallengeMiddleware(cfg, logger),
+		createProxyHandler(cfg.Services.AuthServiceURL+"/auth/register", http.MethodPost, logger))
 	authGroup.Router.POST("/verify-email", createProxyHandler(cfg.Services.AuthServiceURL+"/auth/verify-email", http.MethodPost, logger))
-	authGroup.Router.POST("/login", createProxyHandler(cfg.Services.AuthServiceURL+"/auth/login", http.MethodPost, logger))
+	authGroup.Router.POST("/login",
+		middleware.ChallengeMiddleware(cfg, logger),
+		middleware.LoginProtectionMiddleware(cfg, logger, services.redis),
+		middleware.SessionCookieMiddleware(cfg, logger),
+		createProxyHandler(cfg.Services.AuthServiceURL+"/auth/login", http.MethodPost, logger))
+
+	// Session endpoints for the cookie-based web frontend
+	if cfg.Session.CookieMode {
+		authGroup.Router.POST("/refresh",
+			middleware.RefreshCookieMiddleware(cfg, logger),
+			middleware.SessionCookieMiddleware(cfg, logger),
+			createProxyHandler(cfg.Services.AuthServiceURL+"/auth/refresh", http.MethodPost, logger))
+		authGroup.Router.GET("/csrf", middleware.CSRFTokenHandler(cfg, logger))
+		authGroup.Router.POST("/logout", middleware.LogoutHandler(cfg, logger))
+	}
+
+	// Social login through external OpenID Connect providers
+	registerOIDCRoutes(authGroup.Router, cfg, logger)
 }
 
 // registerUserRoutes sets up all user-related routes
-func registerUserRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger) {
+func registerUserRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger, services *sharedServices) {
 	// Public user routes
-	publicGroup := newPublicGroup(router, cfg, logger)
+	publicGroup := newPublicGroup(router, cfg, logger, services, constants.UpstreamUser)
 	publicGroup.Router.GET("/health", createProxyHandler(cfg.Services.UserServiceURL+"/health", http.MethodGet, logger))
 
-	// Protected user routes
-	protectedGroup := newProtectedGroup(router, cfg, logger, []string{constants.RoleUser})
-	protectedGroup.Router.POST("/profile", createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/profile", http.MethodPost, logger))
-	protectedGroup.Router.GET("/profile", createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/profile", http.MethodGet, logger))
+	// Protected user routes, also reachable by partner API keys
+	protectedGroup := newProtectedGroup(router, cfg, logger, services, constants.UpstreamUser,
+		[]string{constants.RoleUser, constants.RolePartner},
+		constants.AuthMethodJWT, constants.AuthMethodAPIKey)
+
+	// Unverified accounts may only use the exempt routes
+	protectedGroup.Router.Use(middleware.VerificationMiddleware(cfg, logger, services.audit, cfg.Verification.RequiredClaims...))
+
+	// API keys additionally need the scope of each route
+	profilesRead := middleware.ScopeAuthMiddleware([]string{constants.ScopeProfilesRead}, logger)
+	profilesWrite := middleware.ScopeAuthMiddleware([]string{constants.ScopeProfilesWrite}, logger)
+
+	protectedGroup.Router.POST("/profile", profilesWrite, createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/profile", http.MethodPost, logger))
+	protectedGroup.Router.GET("/profile", profilesRead, createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/profile", http.MethodGet, logger))
+
+	// Profile search; its rate limit cost can grow with page size and filters (see RATE_LIMIT_POLICIES_FILE)
+	protectedGroup.Router.GET("/search", profilesRead, createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/search", http.MethodGet, logger))
+
+	// User-scoped resources; only the owner (or a moderator/admin) may access them
+	ownedByPathUser := middleware.OwnershipMiddleware(cfg, logger, middleware.OwnershipRule{Param: "id", BodyField: "user_id"})
+	protectedGroup.Router.GET("/:id/photos", profilesRead, ownedByPathUser,
+		createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/:id/photos", http.MethodGet, logger))
+	protectedGroup.Router.POST("/:id/photos", profilesWrite, ownedByPathUser,
+		createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/:id/photos", http.MethodPost, logger))
+	protectedGroup.Router.DELETE("/:id/photos/:photoId", profilesWrite, ownedByPathUser,
+		createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/:id/photos/:photoId", http.MethodDelete, logger))
+
+	// Premium features, metered per day by subscription plan
+	protectedGroup.Router.GET("/:id/contact",
+		middleware.ScopeAuthMiddleware([]string{constants.ScopeContactsRead}, logger),
+		middleware.EntitlementMiddleware(cfg, logger, services.redis, constants.FeatureContactView),
+		createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/:id/contact", http.MethodGet, logger))
+	protectedGroup.Router.POST("/:id/interests",
+		middleware.ScopeAuthMiddleware([]string{constants.ScopeInterestsWrite}, logger),
+		middleware.EntitlementMiddleware(cfg, logger, services.redis, constants.FeatureInterestSend),
+		createProxyHandler(cfg.Services.UserServiceURL+"/api/v1/user/:id/interests", http.MethodPost, logger))
 }
 
 // registerAdminRoutes sets up all admin-related routes
-func registerAdminRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger) {
+func registerAdminRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.Logger, services *sharedServices) {
 	// Public admin routes
-	publicGroup := newPublicGroup(router, cfg, logger)
+	publicGroup := newPublicGroup(router, cfg, logger, services, constants.UpstreamAdmin)
 	publicGroup.Router.GET("/health", createProxyHandler(cfg.Services.AdminServiceURL+"/health", http.MethodGet, logger))
 
-	// Protected admin routes
-	// protectedGroup := newProtectedGroup(router, cfg, logger, []string{constants.RoleAdmin})
-	// Add protected admin routes as needed
+	// Protected admin routes; the policy file decides which admins may call each one
+	protectedGroup := newProtectedGroup(router, cfg, logger, services, constants.UpstreamAdmin, []string{constants.RoleAdmin})
+	protectedGroup.Router.GET("/users", createProxyHandler(cfg.Services.AdminServiceURL+"/api/v1/admin/users", http.MethodGet, logger))
+	protectedGroup.Router.GET("/users/:id", createProxyHandler(cfg.Services.AdminServiceURL+"/api/v1/admin/users/:id", http.MethodGet, logger))
+
+	// Sensitive actions additionally require a recent MFA login
+	stepUp := newStepUpHandler(cfg, logger)
+	protectedGroup.Router.POST("/users/:id/ban", stepUp,
+		createProxyHandler(cfg.Services.AdminServiceURL+"/api/v1/admin/users/:id/ban", http.MethodPost, logger))
+	protectedGroup.Router.POST("/profiles/:id/verify", stepUp,
+		createProxyHandler(cfg.Services.AdminServiceURL+"/api/v1/admin/profiles/:id/verify", http.MethodPost, logger))
+
+	// Support staff can inspect and clear the limiter state of throttled callers
+	registerRateLimitAdminRoutes(protectedGroup.Router, cfg, logger, services)
+
+	// Monitoring of the outbound limits protecting the upstream services
+	registerOutboundAdminRoutes(protectedGroup.Router, services)
+
+	// Support staff can act as a member to debug their profile
+	if cfg.Impersonation.Enabled {
+		protectedGroup.Router.POST("/users/:id/impersonate", stepUp, createImpersonationHandler(cfg, logger, services.audit))
+	}
+}
+
+// newStepUpHandler returns the step-up check for sensitive routes, or a no-op when disabled
+func newStepUpHandler(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
+	if !cfg.StepUp.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	return middleware.StepUpMiddleware(logger, middleware.StepUpRequirement{
+		ACRValues: cfg.StepUp.ACRValues,
+		AMRValues: cfg.StepUp.AMRValues,
+		MaxAge:    cfg.StepUp.MaxAge,
+	})
 }
 
 // createProxyHandler creates a handler function that forwards requests to a service
 // It acts as a reverse proxy, handling requests and responses between the client and the service.
+// Path parameters such as ":id" in serviceURL are replaced with the values from the request.
 func createProxyHandler(serviceURL string, method string, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		serviceURL, err := resolveServiceURL(serviceURL, c)
+		if err != nil {
+			c.Error(apiErrors.BadRequestError("Invalid path parameter", err))
+			return
+		}
+
 		// Create a new HTTP client with a timeout to avoid hanging requests.
 		client := &http.Client{Timeout: requestTimeout}
 
-		// Variables for the new request and any potential error.
+		// Variable for the new request.
 		var req *http.Request
-		var err error
 
 		// Handle the request based on its HTTP method.
 		// GET and DELETE requests don't have a body.
@@ -153,24 +326,29 @@ func createProxyHandler(serviceURL string, method string, logger *zap.Logger) gi
 			}
 		}
 
-		// If there is user information available from previous authentication middleware,
-		// add it as headers in the outgoing request for tracing purposes.
-		if user, exists := c.Get("user"); exists {
-			// Assert the user information to the expected type.
-			if userClaims, ok := user.(*middleware.UserClaims); ok {
-				req.Header.Set(constants.HeaderUserID, userClaims.UserID)
-				if userClaims.Email != "" {
-					req.Header.Set(constants.HeaderUsername, userClaims.Email)
-				}
-				// If the user has any roles, the first role is added as a header.
-				if len(userClaims.Roles) > 0 {
-					req.Header.Set(constants.HeaderUserRole, userClaims.Roles[0])
-				}
-			}
+		// Wait for the upstream to have capacity, after every check has passed
+		release, ok := middleware.AcquireUpstream(c)
+		if !ok {
+			return
+		}
+		defer release()
+
+		// Take a concurrency slot only for the upstream call itself
+		releaseSlot, ok := middleware.AcquireConcurrencySlot(c)
+		if !ok {
+			return
 		}
+		defer releaseSlot()
 
-		// Send the request to the target service using the HTTP client.
+		// Send the request to the target service using the HTTP client, timing only
+		// the upstream call for the load shedder.
+		start := time.Now()
 		resp, err := client.Do(req)
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		middleware.RecordUpstreamResult(c, time.Since(start), status, err)
 
 		if err != nil {
 			// Log the error and return a service unavailable response if the request fails.
@@ -196,6 +374,27 @@ func createProxyHandler(serviceURL string, method string, logger *zap.Logger) gi
 	}
 }
 
+// resolveServiceURL fills in the path parameters of a service URL and appends the
+// query string of the incoming request. Parameters that are empty, "." or ".."
+// are rejected, as they would move the request outside the route's path.
+func resolveServiceURL(serviceURL string, c *gin.Context) (string, error) {
+	segments := strings.Split(serviceURL, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			value := c.Param(segment[1:])
+			if value == "" || value == "." || value == ".." {
+				return "", fmt.Errorf("path parameter %s must not be %q", segment[1:], value)
+			}
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	serviceURL = strings.Join(segments, "/")
+	if c.Request.URL.RawQuery != "" {
+		serviceURL += "?" + c.Request.URL.RawQuery
+	}
+	return serviceURL, nil
+}
+
 // createHealthHandler creates a simple health check endpoint that checks the status of all services.
 // It makes GET requests to the health endpoint of each service and aggregates the results.
 func createHealthHandler(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc {
@@ -245,3 +444,38 @@ func createHealthHandler(cfg *config.Config, logger *zap.Logger) gin.HandlerFunc
 		})
 	}
 }
+
+// createReadinessHandler creates an endpoint for load balancers and orchestrators
+// that reports whether the gateway can serve traffic. Unlike the health check it
+// only covers the gateway's own dependencies, not the upstream services.
+func createReadinessHandler(cfg *config.Config, logger *zap.Logger, redisClient redis.UniversalClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ready := true
+		checks := map[string]string{}
+
+		// Check Redis, which holds rate limit counters, login failures, quotas and entitlements
+		if err := redisclient.Ping(redisClient, 2*time.Second); err == nil {
+			checks["redis"] = "up"
+		} else {
+			checks["redis"] = "down"
+			logger.Warn("Redis is unreachable", zap.Error(err))
+			if cfg.Readiness.RequireRedis {
+				ready = false
+			}
+		}
+
+		status := http.StatusOK
+		state := "ready"
+		if !ready {
+			status = http.StatusServiceUnavailable
+			state = "not_ready"
+		}
+		c.JSON(status, gin.H{
+			"status": state,
+			"data": gin.H{
+				"checks":    checks,
+				"timestamp": time.Now(),
+			},
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchRoute reports whether a request matches a route pattern.
+// Patterns have the form "[METHOD ]PATH", for example "GET /api/v1/users/*" or
+// "/api/v1/auth/login". A missing method or "*" matches every method.
+func MatchRoute(pattern, method, requestPath string) bool {
+	patternMethod, patternPath := "*", strings.TrimSpace(pattern)
+	if fields := strings.Fields(pattern); len(fields) == 2 {
+		patternMethod, patternPath = fields[0], fields[1]
+	}
+
+	if patternMethod != "*" && !strings.EqualFold(patternMethod, method) {
+		return false
+	}
+	return MatchPath(patternPath, requestPath)
+}
+
+// MatchAnyRoute reports whether a request matches at least one route pattern
+func MatchAnyRoute(patterns []string, method, requestPath string) bool {
+	for _, pattern := range patterns {
+		if MatchRoute(pattern, method, requestPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPath reports whether a path matches a path pattern. "*" matches a
+// single segment, and a trailing "/*" matches everything below that prefix.
+func MatchPath(pattern, requestPath string) bool {
+	if strings.HasSuffix(pattern, "/*") {
+		prefix := strings.TrimSuffix(pattern, "*")
+		if strings.HasPrefix(requestPath, prefix) || requestPath+"/" == prefix {
+			return true
+		}
+	}
+
+	matched, err := path.Match(pattern, requestPath)
+	return err == nil && matched
+}